@@ -3,6 +3,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -83,11 +84,30 @@ type MicroserviceSpec struct {
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Minimum=1
 	Replicas int32 `json:"replicas"`
+
+	// Autoscaling bounds for the generated HorizontalPodAutoscaler.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// Compute resources for the service container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// API gateway exposure of the service's endpoints.
+	// +optional
+	Gateway *GatewaySpec `json:"gateway,omitempty"`
 }
 
 // DeepCopyInto copies the receiver into out.
 func (s *MicroserviceSpec) DeepCopyInto(out *MicroserviceSpec) {
 	*out = *s
+	if s.Autoscaling != nil {
+		out.Autoscaling = s.Autoscaling.DeepCopy()
+	}
+	s.Resources.DeepCopyInto(&out.Resources)
+	if s.Gateway != nil {
+		out.Gateway = s.Gateway.DeepCopy()
+	}
 }
 
 // DeepCopy creates a deep copy of MicroserviceSpec
@@ -100,6 +120,78 @@ func (s *MicroserviceSpec) DeepCopy() *MicroserviceSpec {
 	return out
 }
 
+// AutoscalingSpec defines the HorizontalPodAutoscaler bounds of a Microservice
+type AutoscalingSpec struct {
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	TargetCPUUtilization int32 `json:"targetCPUUtilization,omitempty"`
+}
+
+// DeepCopyInto copies the receiver into out.
+func (s *AutoscalingSpec) DeepCopyInto(out *AutoscalingSpec) {
+	*out = *s
+}
+
+// DeepCopy creates a deep copy of AutoscalingSpec
+func (s *AutoscalingSpec) DeepCopy() *AutoscalingSpec {
+	if s == nil {
+		return nil
+	}
+	out := new(AutoscalingSpec)
+	s.DeepCopyInto(out)
+	return out
+}
+
+// GatewaySpec defines how the API gateway exposes a Microservice
+type GatewaySpec struct {
+	// Roles required on every endpoint, in addition to per-operation roles
+	// from the service's OpenAPI document.
+	// +optional
+	Roles []string `json:"roles,omitempty"`
+
+	// JWT claims forwarded to the service as request headers.
+	// +optional
+	PropagateClaims []ClaimHeader `json:"propagateClaims,omitempty"`
+}
+
+// ClaimHeader maps a JWT claim to the header it is forwarded in
+type ClaimHeader struct {
+	Claim  string `json:"claim"`
+	Header string `json:"header"`
+}
+
+// DeepCopyInto copies the receiver into out.
+func (s *GatewaySpec) DeepCopyInto(out *GatewaySpec) {
+	*out = *s
+	if s.Roles != nil {
+		out.Roles = make([]string, len(s.Roles))
+		copy(out.Roles, s.Roles)
+	}
+	if s.PropagateClaims != nil {
+		out.PropagateClaims = make([]ClaimHeader, len(s.PropagateClaims))
+		copy(out.PropagateClaims, s.PropagateClaims)
+	}
+}
+
+// DeepCopy creates a deep copy of GatewaySpec
+func (s *GatewaySpec) DeepCopy() *GatewaySpec {
+	if s == nil {
+		return nil
+	}
+	out := new(GatewaySpec)
+	s.DeepCopyInto(out)
+	return out
+}
+
 // MicroserviceStatus defines the observed state of Microservice
 type MicroserviceStatus struct {
 	// The generation observed by the deployment controller.
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var apiCmd = &cobra.Command{
+	Use:   "api METHOD PATH",
+	Short: "Call a platform API with the stored token",
+	Example: `  scalebit-cli api GET /orders
+  scalebit-cli api POST /products -d '{"name":"Widget","price":9.5,"stock":10}'
+  scalebit-cli api PUT /orders/7 -d @order.json`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		method := strings.ToUpper(args[0])
+		path := args[1]
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		data, _ := cmd.Flags().GetString("data")
+
+		var body interface{}
+		if data != "" {
+			raw := []byte(data)
+			if strings.HasPrefix(data, "@") {
+				var err error
+				if raw, err = os.ReadFile(data[1:]); err != nil {
+					return err
+				}
+			}
+			if !json.Valid(raw) {
+				return fmt.Errorf("request body is not valid JSON")
+			}
+			body = json.RawMessage(raw)
+		}
+
+		c, err := authenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+		var out json.RawMessage
+		if err := c.Do(cmd.Context(), method, path, body, &out); err != nil {
+			return err
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, out, "", "  "); err != nil {
+			pretty.Write(out)
+		}
+		pretty.WriteByte('\n')
+		_, err = pretty.WriteTo(cmd.OutOrStdout())
+		return err
+	},
+}
+
+func init() {
+	apiCmd.Flags().StringP("data", "d", "", "JSON request body, or @file to read it from a file")
+	rootCmd.AddCommand(apiCmd)
+}
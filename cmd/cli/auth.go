@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/pkg/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to the platform and store the token for the active profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		url, _ := cmd.Flags().GetString("url")
+		email, _ := cmd.Flags().GetString("email")
+		passwordStdin, _ := cmd.Flags().GetBool("password-stdin")
+
+		creds, err := loadCredentials()
+		if err != nil {
+			return err
+		}
+		name := creds.profileName(cmd)
+		p := creds.profile(name)
+		if url != "" {
+			p.URL = url
+		}
+
+		reader := bufio.NewReader(cmd.InOrStdin())
+		if email == "" {
+			email = p.Email
+		}
+		if email == "" {
+			fmt.Fprint(cmd.OutOrStdout(), "Email: ")
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			email = strings.TrimSpace(line)
+		}
+		var password string
+		if !passwordStdin && term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Fprint(cmd.OutOrStdout(), "Password: ")
+			raw, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(cmd.OutOrStdout())
+			if err != nil {
+				return err
+			}
+			password = string(raw)
+		} else {
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("read password: %w", err)
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+
+		users, err := client.NewUsersClient(p.URL)
+		if err != nil {
+			return err
+		}
+		resp, err := users.Login(cmd.Context(), email, password)
+		if err != nil {
+			return fmt.Errorf("login failed: %w", err)
+		}
+		if err := p.setToken(resp.Token); err != nil {
+			return err
+		}
+		p.Email = email
+		creds.Current = name
+		if err := creds.save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Logged in to %s as %s (%s) using profile %q; token expires %s\n",
+			p.URL, email, resp.Role, name, p.ExpiresAt.Local().Format(time.RFC1123))
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the stored token of the active profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		creds, err := loadCredentials()
+		if err != nil {
+			return err
+		}
+		name := creds.profileName(cmd)
+		p, ok := creds.Profiles[name]
+		if !ok || p.Token == "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "Not logged in to profile %q\n", name)
+			return nil
+		}
+		p.Token = ""
+		p.ExpiresAt = time.Time{}
+		if err := creds.save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Logged out of profile %q\n", name)
+		return nil
+	},
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the user of the active profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, token, err := activeToken(cmd.Context(), cmd)
+		if err != nil {
+			return err
+		}
+		claims, err := tokenClaims(token)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "URL:     %s\n", p.URL)
+		fmt.Fprintf(out, "User:    %v <%v>\n", claims["name"], claims["email"])
+		fmt.Fprintf(out, "ID:      %v\n", claims["id"])
+		fmt.Fprintf(out, "Role:    %v\n", claims["role"])
+		fmt.Fprintf(out, "Expires: %s\n", p.ExpiresAt.Local().Format(time.RFC1123))
+		return nil
+	},
+}
+
+func init() {
+	loginCmd.Flags().String("url", "", "API base URL for the profile (default "+defaultAPIURL+")")
+	loginCmd.Flags().String("email", "", "Account email")
+	loginCmd.Flags().Bool("password-stdin", false, "Read the password from stdin")
+	rootCmd.PersistentFlags().String("profile", "", "Credentials profile (e.g. dev, staging, prod); defaults to $SCALEBIT_PROFILE or the last login")
+	rootCmd.AddCommand(loginCmd, logoutCmd, whoamiCmd)
+}
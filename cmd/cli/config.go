@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/gateway"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultProjectConfig = "scalebit.yaml"
+
+// projectConfig is the layout of a scalebit.yaml file at the project root.
+type projectConfig struct {
+	Registry  string           `json:"registry,omitempty"`
+	Namespace string           `json:"namespace,omitempty"`
+	Defaults  serviceDefaults  `json:"defaults,omitempty"`
+	Gateway   gateway.Settings `json:"gateway,omitempty"`
+}
+
+// serviceDefaults are applied to every service scaffolded in the project
+// unless overridden by a flag or an interactive answer.
+type serviceDefaults struct {
+	Lang          string `json:"lang,omitempty"`
+	Port          int32  `json:"port,omitempty"`
+	Replicas      int32  `json:"replicas,omitempty"`
+	MinReplicas   int32  `json:"minReplicas,omitempty"`
+	MaxReplicas   int32  `json:"maxReplicas,omitempty"`
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+}
+
+// loadProjectConfig reads the project config at path. A missing file is only
+// an error when the path was given explicitly.
+func loadProjectConfig(path string, explicit bool) (*projectConfig, error) {
+	cfg := &projectConfig{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
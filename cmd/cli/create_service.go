@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// serviceOptions holds everything needed to scaffold a service. Values are
+// resolved in order: built-in defaults, scalebit.yaml, flags, prompts.
+type serviceOptions struct {
+	Name          string
+	Lang          string
+	Registry      string
+	Namespace     string
+	Port          int32
+	Replicas      int32
+	MinReplicas   int32
+	MaxReplicas   int32
+	CPURequest    string
+	CPULimit      string
+	MemoryRequest string
+	MemoryLimit   string
+}
+
+// optionField binds a create-service flag to the option it sets, so flags and
+// interactive prompts share one table.
+type optionField struct {
+	flag  string
+	label string
+	str   *string
+	num   *int32
+}
+
+func (o *serviceOptions) fields() []optionField {
+	return []optionField{
+		{flag: "lang", label: "Language template", str: &o.Lang},
+		{flag: "port", label: "Port", num: &o.Port},
+		{flag: "replicas", label: "Replicas", num: &o.Replicas},
+		{flag: "registry", label: "Image registry", str: &o.Registry},
+		{flag: "namespace", label: "Namespace", str: &o.Namespace},
+		{flag: "min-replicas", label: "Autoscaling min replicas", num: &o.MinReplicas},
+		{flag: "max-replicas", label: "Autoscaling max replicas", num: &o.MaxReplicas},
+		{flag: "cpu-request", label: "CPU request", str: &o.CPURequest},
+		{flag: "cpu-limit", label: "CPU limit", str: &o.CPULimit},
+		{flag: "memory-request", label: "Memory request", str: &o.MemoryRequest},
+		{flag: "memory-limit", label: "Memory limit", str: &o.MemoryLimit},
+	}
+}
+
+func defaultServiceOptions(cfg *projectConfig) serviceOptions {
+	o := serviceOptions{
+		Lang:        "go",
+		Port:        8080,
+		Replicas:    1,
+		MinReplicas: 1,
+		MaxReplicas: 5,
+	}
+	d := cfg.Defaults
+	setString(&o.Lang, d.Lang)
+	setString(&o.Registry, cfg.Registry)
+	setString(&o.Namespace, cfg.Namespace)
+	setInt32(&o.Port, d.Port)
+	setInt32(&o.Replicas, d.Replicas)
+	setInt32(&o.MinReplicas, d.MinReplicas)
+	setInt32(&o.MaxReplicas, d.MaxReplicas)
+	setString(&o.CPURequest, d.CPURequest)
+	setString(&o.CPULimit, d.CPULimit)
+	setString(&o.MemoryRequest, d.MemoryRequest)
+	setString(&o.MemoryLimit, d.MemoryLimit)
+	return o
+}
+
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+func setInt32(dst *int32, v int32) {
+	if v != 0 {
+		*dst = v
+	}
+}
+
+// applyFlags overrides options with every flag set explicitly on the command line.
+func (o *serviceOptions) applyFlags(cmd *cobra.Command) error {
+	for _, f := range o.fields() {
+		if !cmd.Flags().Changed(f.flag) {
+			continue
+		}
+		var err error
+		if f.num != nil {
+			*f.num, err = cmd.Flags().GetInt32(f.flag)
+		} else {
+			*f.str, err = cmd.Flags().GetString(f.flag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prompt asks for the service name (if missing) and every option not set by a
+// flag, offering the current value as the default.
+func (o *serviceOptions) prompt(cmd *cobra.Command, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	ask := func(label, def string) (string, error) {
+		if def != "" {
+			fmt.Fprintf(out, "%s [%s]: ", label, def)
+		} else {
+			fmt.Fprintf(out, "%s: ", label)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			return def, nil
+		}
+		return line, nil
+	}
+
+	if o.Name == "" {
+		name, err := ask("Service name", "")
+		if err != nil {
+			return err
+		}
+		o.Name = name
+	}
+	for _, f := range o.fields() {
+		if cmd.Flags().Changed(f.flag) {
+			continue
+		}
+		if f.num == nil {
+			v, err := ask(f.label, *f.str)
+			if err != nil {
+				return err
+			}
+			*f.str = v
+			continue
+		}
+		v, err := ask(f.label, strconv.Itoa(int(*f.num)))
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.label, v)
+		}
+		*f.num = int32(n)
+	}
+	return nil
+}
+
+func (o *serviceOptions) validate() error {
+	if errs := validation.IsDNS1123Label(o.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid service name %q: %s", o.Name, strings.Join(errs, "; "))
+	}
+	if o.Namespace != "" {
+		if errs := validation.IsDNS1123Label(o.Namespace); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q: %s", o.Namespace, strings.Join(errs, "; "))
+		}
+	}
+	if o.Port < 1 || o.Port > 65535 {
+		return fmt.Errorf("invalid port %d: must be between 1 and 65535", o.Port)
+	}
+	if o.Replicas < 1 {
+		return fmt.Errorf("invalid replicas %d: must be at least 1", o.Replicas)
+	}
+	if o.MinReplicas < 1 {
+		return fmt.Errorf("invalid min replicas %d: must be at least 1", o.MinReplicas)
+	}
+	if o.MaxReplicas < o.MinReplicas {
+		return fmt.Errorf("max replicas %d is lower than min replicas %d", o.MaxReplicas, o.MinReplicas)
+	}
+	if o.Replicas < o.MinReplicas || o.Replicas > o.MaxReplicas {
+		return fmt.Errorf("invalid replicas %d: must be between min replicas %d and max replicas %d", o.Replicas, o.MinReplicas, o.MaxReplicas)
+	}
+	if err := validateResourcePair("cpu", o.CPURequest, o.CPULimit); err != nil {
+		return err
+	}
+	return validateResourcePair("memory", o.MemoryRequest, o.MemoryLimit)
+}
+
+func validateResourcePair(name, request, limit string) error {
+	var req, lim resource.Quantity
+	var err error
+	if request != "" {
+		if req, err = resource.ParseQuantity(request); err != nil {
+			return fmt.Errorf("invalid %s request %q: %v", name, request, err)
+		}
+	}
+	if limit != "" {
+		if lim, err = resource.ParseQuantity(limit); err != nil {
+			return fmt.Errorf("invalid %s limit %q: %v", name, limit, err)
+		}
+	}
+	if request != "" && limit != "" && lim.Cmp(req) < 0 {
+		return fmt.Errorf("%s limit %s is lower than request %s", name, limit, request)
+	}
+	return nil
+}
+
+// Image returns the container image reference for the service.
+func (o *serviceOptions) Image() string {
+	if o.Registry == "" {
+		return o.Name + ":latest"
+	}
+	return strings.TrimSuffix(o.Registry, "/") + "/" + o.Name + ":latest"
+}
+
+var microserviceManifest = template.Must(template.New("microservice").Parse(`apiVersion: scalebit.moodykhalif23.github.com/v1alpha1
+kind: Microservice
+metadata:
+  name: {{.Name}}
+{{- if .Namespace}}
+  namespace: {{.Namespace}}
+{{- end}}
+spec:
+  image: {{.Image}}
+  port: {{.Port}}
+  replicas: {{.Replicas}}
+  autoscaling:
+    minReplicas: {{.MinReplicas}}
+    maxReplicas: {{.MaxReplicas}}
+{{- if or .CPURequest .MemoryRequest .CPULimit .MemoryLimit}}
+  resources:
+{{- if or .CPURequest .MemoryRequest}}
+    requests:
+{{- if .CPURequest}}
+      cpu: "{{.CPURequest}}"
+{{- end}}
+{{- if .MemoryRequest}}
+      memory: "{{.MemoryRequest}}"
+{{- end}}
+{{- end}}
+{{- if or .CPULimit .MemoryLimit}}
+    limits:
+{{- if .CPULimit}}
+      cpu: "{{.CPULimit}}"
+{{- end}}
+{{- if .MemoryLimit}}
+      memory: "{{.MemoryLimit}}"
+{{- end}}
+{{- end}}
+{{- end}}
+`))
+
+// scaffoldService renders the language template and the Microservice manifest
+// into outputDir.
+func scaffoldService(o *serviceOptions, outputDir string) error {
+	templateDir := filepath.Join("internal", "pkg", "cli", "templates", o.Lang+"-service")
+	if _, err := os.Stat(templateDir); err != nil {
+		return fmt.Errorf("unknown language template %q: %v", o.Lang, err)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	replacer := strings.NewReplacer(
+		"{{SERVICE_NAME}}", o.Name,
+		"{{PORT}}", strconv.Itoa(int(o.Port)),
+	)
+	for _, name := range []string{"main.go", "Dockerfile"} {
+		tmpl, err := os.ReadFile(filepath.Join(templateDir, name))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(outputDir, name), []byte(replacer.Replace(string(tmpl))), 0644); err != nil {
+			return err
+		}
+	}
+
+	// Generate microservice.yaml CRD manifest
+	f, err := os.Create(filepath.Join(outputDir, "microservice.yaml"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return microserviceManifest.Execute(f, o)
+}
+
+var createServiceCmd = &cobra.Command{
+	Use:   "create-service [name]",
+	Short: "Create new microservice",
+	Long: `Scaffold a new microservice from a language template.
+
+Values are taken from built-in defaults, then the project's scalebit.yaml,
+then flags. With --interactive, every value not given as a flag is prompted
+for, using the configured value as the default.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath, _ := cmd.Flags().GetString("config")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+
+		cfg, err := loadProjectConfig(configPath, cmd.Flags().Changed("config"))
+		if err != nil {
+			return err
+		}
+		opts := defaultServiceOptions(cfg)
+		if len(args) == 1 {
+			opts.Name = args[0]
+		}
+		if err := opts.applyFlags(cmd); err != nil {
+			return err
+		}
+		if interactive {
+			if err := opts.prompt(cmd, cmd.InOrStdin(), cmd.OutOrStdout()); err != nil {
+				return err
+			}
+		} else if opts.Name == "" {
+			return fmt.Errorf("service name is required (pass it as an argument or use --interactive)")
+		}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+
+		outputDir := opts.Name
+		if err := scaffoldService(&opts, outputDir); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Service '%s' scaffolded in %s/\n", opts.Name, outputDir)
+		return nil
+	},
+}
+
+func init() {
+	flags := createServiceCmd.Flags()
+	flags.StringP("lang", "l", "go", "Language template")
+	flags.Int32P("port", "p", 8080, "Container port")
+	flags.Int32P("replicas", "r", 1, "Initial replica count")
+	flags.String("registry", "", "Image registry prefix (e.g. ghcr.io/acme)")
+	flags.StringP("namespace", "n", "", "Kubernetes namespace")
+	flags.Int32("min-replicas", 1, "Autoscaling minimum replicas")
+	flags.Int32("max-replicas", 5, "Autoscaling maximum replicas")
+	flags.String("cpu-request", "", "CPU request (e.g. 100m)")
+	flags.String("cpu-limit", "", "CPU limit (e.g. 500m)")
+	flags.String("memory-request", "", "Memory request (e.g. 128Mi)")
+	flags.String("memory-limit", "", "Memory limit (e.g. 256Mi)")
+	flags.String("config", defaultProjectConfig, "Project config file")
+	flags.BoolP("interactive", "i", false, "Prompt for values not given as flags")
+	rootCmd.AddCommand(createServiceCmd)
+}
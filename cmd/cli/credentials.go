@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/moodykhalif23/scalebit/pkg/client"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultProfile = "dev"
+	defaultAPIURL  = "http://localhost:8000"
+	// refreshWindow is how long before expiry a stored token is renewed.
+	refreshWindow = time.Hour
+)
+
+// credentials is the per-user credentials file. It holds bearer tokens, so it
+// is only ever written with mode 0600.
+type credentials struct {
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*profile `json:"profiles,omitempty"`
+}
+
+// profile is one environment (dev, staging, prod, ...) the CLI can talk to.
+type profile struct {
+	URL       string    `json:"url"`
+	Email     string    `json:"email,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// credentialsPath honours SCALEBIT_CREDENTIALS, falling back to
+// <user config dir>/scalebit/credentials.yaml.
+func credentialsPath() (string, error) {
+	if p := os.Getenv("SCALEBIT_CREDENTIALS"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scalebit", "credentials.yaml"), nil
+}
+
+func loadCredentials() (*credentials, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	creds := &credentials{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// save writes the file atomically so a crash never leaves a truncated file.
+func (c *credentials) save() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// profileName resolves the active profile: --profile, then SCALEBIT_PROFILE,
+// then the profile of the last login, then "dev".
+func (c *credentials) profileName(cmd *cobra.Command) string {
+	if name, _ := cmd.Flags().GetString("profile"); name != "" {
+		return name
+	}
+	if name := os.Getenv("SCALEBIT_PROFILE"); name != "" {
+		return name
+	}
+	if c.Current != "" {
+		return c.Current
+	}
+	return defaultProfile
+}
+
+func (c *credentials) profile(name string) *profile {
+	if c.Profiles == nil {
+		c.Profiles = map[string]*profile{}
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		p = &profile{URL: defaultAPIURL}
+		c.Profiles[name] = p
+	}
+	return p
+}
+
+// tokenClaims decodes the claims of a token issued by the user service. The
+// signature is not checked: the CLI only reads its own stored token.
+func tokenClaims(token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	return claims, nil
+}
+
+func (p *profile) setToken(token string) error {
+	claims, err := tokenClaims(token)
+	if err != nil {
+		return err
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return fmt.Errorf("token has no expiry")
+	}
+	p.Token = token
+	p.ExpiresAt = exp.Time
+	return nil
+}
+
+// activeToken returns the stored token of the active profile, refreshing it
+// through the user service when it is about to expire.
+func activeToken(ctx context.Context, cmd *cobra.Command) (*profile, string, error) {
+	creds, err := loadCredentials()
+	if err != nil {
+		return nil, "", err
+	}
+	name := creds.profileName(cmd)
+	p, ok := creds.Profiles[name]
+	if !ok || p.Token == "" {
+		return nil, "", fmt.Errorf("not logged in to profile %q; run `scalebit-cli login`", name)
+	}
+	if time.Now().After(p.ExpiresAt) {
+		return nil, "", fmt.Errorf("session for profile %q expired; run `scalebit-cli login`", name)
+	}
+	if time.Until(p.ExpiresAt) < refreshWindow {
+		users, err := client.NewUsersClient(p.URL, client.WithToken(p.Token))
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := users.Refresh(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("refresh token: %w", err)
+		}
+		if err := p.setToken(resp.Token); err != nil {
+			return nil, "", err
+		}
+		if err := creds.save(); err != nil {
+			return nil, "", err
+		}
+	}
+	return p, p.Token, nil
+}
+
+// authenticatedClient returns a client for the active profile's API URL that
+// sends the stored token. Commands that call the platform APIs should use it.
+func authenticatedClient(cmd *cobra.Command) (*client.Client, error) {
+	p, token, err := activeToken(cmd.Context(), cmd)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(p.URL, client.WithToken(token))
+}
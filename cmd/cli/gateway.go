@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/moodykhalif23/scalebit/api/v1alpha1"
+	"github.com/moodykhalif23/scalebit/internal/pkg/gateway"
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var gatewayCmd = &cobra.Command{
+	Use:   "gateway",
+	Short: "Manage the API gateway configuration",
+}
+
+var gatewayGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate the KrakenD config from Microservice manifests and OpenAPI documents",
+	Long: `Generate the KrakenD config from Microservice manifests and OpenAPI documents.
+
+Every Microservice manifest matching --manifests contributes the endpoints of
+its OpenAPI document in --openapi-dir (<name>.json), routed to
+http://<name>:<port>. Gateway-wide settings come from the "gateway" section
+of scalebit.yaml. With --check the output file is compared instead of
+written, and the command fails if it is out of date.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifests, _ := cmd.Flags().GetString("manifests")
+		specDir, _ := cmd.Flags().GetString("openapi-dir")
+		output, _ := cmd.Flags().GetString("output")
+		configPath, _ := cmd.Flags().GetString("config")
+		check, _ := cmd.Flags().GetBool("check")
+
+		cfg, err := loadProjectConfig(configPath, cmd.Flags().Changed("config"))
+		if err != nil {
+			return err
+		}
+		services, err := loadGatewayServices(manifests, specDir)
+		if err != nil {
+			return err
+		}
+		generated, err := gateway.KrakenD(cfg.Gateway.Merge(gateway.DefaultSettings()), services)
+		if err != nil {
+			return err
+		}
+
+		current, err := os.ReadFile(output)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if check {
+			if d := unifiedDiff(output, "generated", string(current), string(generated)); d != "" {
+				fmt.Fprint(cmd.OutOrStdout(), d)
+				return fmt.Errorf("%s is out of date; run `scalebit-cli gateway generate`", output)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is up to date\n", output)
+			return nil
+		}
+		if err := os.WriteFile(output, generated, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s (%d services)\n", output, len(services))
+		return nil
+	},
+}
+
+// loadGatewayServices reads every Microservice manifest matching pattern and
+// the OpenAPI document named after it, sorted by service name.
+func loadGatewayServices(pattern, specDir string) ([]gateway.Service, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no Microservice manifests match %s", pattern)
+	}
+	var services []gateway.Service
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var ms v1alpha1.Microservice
+		if err := yaml.Unmarshal(data, &ms); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", p, err)
+		}
+		if ms.Kind != "Microservice" {
+			continue
+		}
+		specPath := filepath.Join(specDir, ms.Name+".json")
+		specData, err := os.ReadFile(specPath)
+		if err != nil {
+			return nil, fmt.Errorf("OpenAPI document for %s: %w", ms.Name, err)
+		}
+		var doc openapi.Document
+		if err := json.Unmarshal(specData, &doc); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", specPath, err)
+		}
+		services = append(services, gateway.Service{Microservice: ms, Spec: &doc})
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Microservice.Name < services[j].Microservice.Name
+	})
+	return services, nil
+}
+
+func init() {
+	flags := gatewayGenerateCmd.Flags()
+	flags.String("manifests", filepath.Join("internal", "pkg", "services", "*", "microservice.yaml"), "Glob of Microservice manifests")
+	flags.String("openapi-dir", defaultOpenAPIDir, "Directory holding the OpenAPI documents")
+	flags.StringP("output", "o", filepath.Join("deployments", "aws", "krakend.json"), "KrakenD config file")
+	flags.String("config", defaultProjectConfig, "Project config file")
+	flags.Bool("check", false, "Fail if the output file is out of date instead of writing it")
+	gatewayCmd.AddCommand(gatewayGenerateCmd)
+	rootCmd.AddCommand(gatewayCmd)
+}
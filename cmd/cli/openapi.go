@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultOpenAPIDir = "api/openapi"
+
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Manage the OpenAPI documents of the core services",
+}
+
+var openapiGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Regenerate the committed OpenAPI documents from the service route tables",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for _, svc := range coreServices {
+			path := filepath.Join(dir, svc.Name+".json")
+			current, generated, err := loadAndRenderSpec(svc, path)
+			if err != nil {
+				return err
+			}
+			if d := unifiedDiff(path, path, current, generated); d != "" {
+				fmt.Fprint(cmd.OutOrStdout(), d)
+			}
+			if err := os.WriteFile(path, []byte(generated), 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\n", path)
+		}
+		return nil
+	},
+}
+
+var openapiDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show how the committed OpenAPI documents differ from the services; fails if they do",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		stale := 0
+		for _, svc := range coreServices {
+			path := filepath.Join(dir, svc.Name+".json")
+			current, generated, err := loadAndRenderSpec(svc, path)
+			if err != nil {
+				return err
+			}
+			if d := unifiedDiff(path, svc.Name+" (generated)", current, generated); d != "" {
+				fmt.Fprint(cmd.OutOrStdout(), d)
+				stale++
+			}
+		}
+		if stale > 0 {
+			return fmt.Errorf("%d OpenAPI document(s) out of date; run `scalebit-cli openapi generate`", stale)
+		}
+		return nil
+	},
+}
+
+// loadAndRenderSpec returns the committed document at path (empty if absent)
+// and the one the service renders with its -openapi flag.
+func loadAndRenderSpec(svc coreService, path string) (string, string, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", err
+	}
+	var stdout, stderr bytes.Buffer
+	c := exec.Command("go", "run", "./"+filepath.Join("internal", "pkg", "services", svc.Dir), "-openapi")
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return "", "", fmt.Errorf("render %s OpenAPI document: %v\n%s", svc.Name, err, stderr.String())
+	}
+	return string(current), stdout.String(), nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{openapiGenerateCmd, openapiDiffCmd} {
+		c.Flags().String("dir", defaultOpenAPIDir, "Directory holding the committed documents")
+		openapiCmd.AddCommand(c)
+	}
+	rootCmd.AddCommand(openapiCmd)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	"github.com/moodykhalif23/scalebit/internal/pkg/security"
+	"github.com/spf13/cobra"
+)
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Work with the service registry",
+}
+
+var registryTokenCmd = &cobra.Command{
+	Use:   "token [SERVICE]",
+	Short: "Issue a registry token for a service",
+	Long: `Issue a JWT that lets a service register itself with a registry started
+with -auth. The token may register, heartbeat and deregister instances of
+SERVICE and read the registry; --read-only issues a token that can only read,
+e.g. for a load balancer. The token is signed with $JWT_SECRET, the secret
+the registry validates tokens with, but only the registry accepts it; pass it
+to the service as REGISTRY_TOKEN.`,
+	Example: `  JWT_SECRET=... scalebit-cli registry token order-service --ttl 720h
+  JWT_SECRET=... scalebit-cli registry token --read-only`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		readOnly, _ := cmd.Flags().GetBool("read-only")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return fmt.Errorf("JWT_SECRET is not set")
+		}
+		scopes := []string{registry.ScopeRead}
+		subject := "registry-reader"
+		switch {
+		case readOnly && len(args) > 0:
+			return fmt.Errorf("--read-only does not take a service")
+		case !readOnly && len(args) == 0:
+			return fmt.Errorf("name the service the token may register, or pass --read-only")
+		case !readOnly:
+			scopes = append(scopes, registry.ScopeRegisterPrefix+args[0])
+			subject = "service:" + args[0]
+		}
+
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":   subject,
+			"scope": strings.Join(scopes, " "),
+			"iat":   now.Unix(),
+			"exp":   now.Add(ttl).Unix(),
+			"iss":   "scalebit-platform",
+			"aud":   security.AudienceRegistry,
+		})
+		signed, err := token.SignedString([]byte(secret))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), signed)
+		return nil
+	},
+}
+
+func init() {
+	registryTokenCmd.Flags().Bool("read-only", false, "Only allow reading the registry")
+	registryTokenCmd.Flags().Duration("ttl", 30*24*time.Hour, "Token lifetime")
+	registryCmd.AddCommand(registryTokenCmd)
+	rootCmd.AddCommand(registryCmd)
+}
@@ -0,0 +1,15 @@
+package main
+
+// coreService identifies one of the platform services shipped in this repo.
+type coreService struct {
+	Name string // Kubernetes Service / Microservice name
+	Dir  string // package directory under internal/pkg/services
+	Port int32
+}
+
+var coreServices = []coreService{
+	{Name: "user-service", Dir: "users", Port: 8080},
+	{Name: "product-service", Dir: "product", Port: 8081},
+	{Name: "order-service", Dir: "order", Port: 8082},
+	{Name: "payment-service", Dir: "payment", Port: 8083},
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry/kubesync"
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func main() {
+	addr := flag.String("addr", envOr("REGISTRY_ADDR", ":8000"), "listen address")
+	interval := flag.Duration("health-interval", envDuration("REGISTRY_HEALTH_INTERVAL", 30*time.Second), "time between health check rounds")
+	timeout := flag.Duration("health-timeout", envDuration("REGISTRY_HEALTH_TIMEOUT", 5*time.Second), "timeout of a single health check")
+	workers := flag.Int("health-workers", envInt("REGISTRY_HEALTH_WORKERS", 8), "number of concurrent health checks")
+	failures := flag.Int("failure-threshold", envInt("REGISTRY_FAILURE_THRESHOLD", 3), "consecutive failed checks before an instance is marked DOWN")
+	successes := flag.Int("success-threshold", envInt("REGISTRY_SUCCESS_THRESHOLD", 1), "consecutive successful checks before an instance is marked UP again")
+	defaultTTL := flag.Duration("default-ttl", envDuration("REGISTRY_DEFAULT_TTL", 0), "TTL of instances that register without one (0 = never expire)")
+	storeKind := flag.String("store", envOr("REGISTRY_STORE", "memory"), "where instances are kept: memory or bolt")
+	dataDir := flag.String("data-dir", envOr("REGISTRY_DATA_DIR", "registry-data"), "directory of the bolt store and the Raft state")
+	raftID := flag.String("raft-id", envOr("REGISTRY_RAFT_ID", ""), "node ID; enables Raft replication")
+	raftAddr := flag.String("raft-addr", envOr("REGISTRY_RAFT_ADDR", ""), "local Raft listen address (default: this node's address in -raft-peers)")
+	raftPeers := flag.String("raft-peers", envOr("REGISTRY_RAFT_PEERS", ""), "cluster members as id=raftAddr=apiURL,...")
+	raftBootstrap := flag.Bool("raft-bootstrap", envOr("REGISTRY_RAFT_BOOTSTRAP", "") == "true", "form a new cluster from -raft-peers on first start")
+	dnsAddr := flag.String("dns-addr", envOr("REGISTRY_DNS_ADDR", ""), "UDP and TCP address of the DNS interface, e.g. :8600 (disabled if empty)")
+	dnsDomain := flag.String("dns-domain", envOr("REGISTRY_DNS_DOMAIN", "scalebit"), "DNS domain; services resolve as <name>.service.<domain>")
+	dnsTTL := flag.Duration("dns-ttl", envDuration("REGISTRY_DNS_TTL", 5*time.Second), "TTL of DNS answers")
+	kubeSync := flag.Bool("kube-sync", envOr("REGISTRY_KUBE_SYNC", "") == "true", "mirror the endpoints of Microservice Services from Kubernetes")
+	kubeNamespace := flag.String("kube-namespace", envOr("REGISTRY_KUBE_NAMESPACE", ""), "only mirror this namespace (default: all)")
+	kubeExport := flag.String("kube-export-namespace", envOr("REGISTRY_KUBE_EXPORT_NAMESPACE", ""), "export registry-only services as selectorless Services into this namespace")
+	auth := flag.Bool("auth", envOr("REGISTRY_AUTH", "") == "true", "require a platform JWT with registry scopes (signed with JWT_SECRET)")
+	anonymousRead := flag.Bool("auth-anonymous-read", envOr("REGISTRY_AUTH_ANONYMOUS_READ", "") == "true", "allow reads without credentials when access control is on")
+	tlsCert := flag.String("tls-cert", envOr("REGISTRY_TLS_CERT", ""), "serve HTTPS with this certificate file")
+	tlsKey := flag.String("tls-key", envOr("REGISTRY_TLS_KEY", ""), "private key of -tls-cert")
+	clientCA := flag.String("tls-client-ca", envOr("REGISTRY_TLS_CLIENT_CA", ""), "verify client certificates against this CA; a certificate's common name may write that service")
+	flag.Parse()
+
+	opts := []registry.Option{
+		registry.WithHealthInterval(*interval),
+		registry.WithHealthTimeout(*timeout),
+		registry.WithHealthWorkers(*workers),
+		registry.WithThresholds(*failures, *successes),
+		registry.WithDefaultTTL(*defaultTTL),
+	}
+	switch *storeKind {
+	case "memory":
+	case "bolt":
+		if err := os.MkdirAll(*dataDir, 0700); err != nil {
+			log.Fatalf("Failed to create data directory: %v", err)
+		}
+		store, err := registry.OpenBoltStore(filepath.Join(*dataDir, "registry.db"))
+		if err != nil {
+			log.Fatalf("Failed to open store: %v", err)
+		}
+		opts = append(opts, registry.WithStore(store))
+	default:
+		log.Fatalf("Unknown store %q, want memory or bolt", *storeKind)
+	}
+	if *raftID != "" {
+		peers, err := registry.ParsePeers(*raftPeers)
+		if err != nil {
+			log.Fatalf("Invalid -raft-peers: %v", err)
+		}
+		opts = append(opts, registry.WithRaft(registry.RaftConfig{
+			ID:        *raftID,
+			BindAddr:  *raftAddr,
+			DataDir:   filepath.Join(*dataDir, "raft"),
+			Bootstrap: *raftBootstrap,
+			Peers:     peers,
+		}))
+	}
+
+	if *clientCA != "" && *tlsCert == "" {
+		log.Fatal("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+	if *auth && os.Getenv("JWT_SECRET") == "" {
+		log.Fatal("-auth requires JWT_SECRET")
+	}
+	if *auth || *clientCA != "" {
+		opts = append(opts, registry.WithPolicy(registry.ScopePolicy(*anonymousRead)))
+	}
+
+	if err := telemetry.RegisterRegistryMetrics(prometheus.DefaultRegisterer); err != nil {
+		log.Fatalf("Failed to register metrics: %v", err)
+	}
+	reg, err := registry.New(opts...)
+	if err != nil {
+		log.Fatalf("Failed to start registry: %v", err)
+	}
+	defer reg.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start health checks in background
+	go reg.Run(ctx)
+
+	if *dnsAddr != "" {
+		go func() {
+			log.Printf("Serving DNS for service.%s on %s", *dnsDomain, *dnsAddr)
+			if err := registry.NewDNSServer(reg, *dnsDomain, *dnsTTL).ListenAndServe(ctx, *dnsAddr); err != nil {
+				log.Fatalf("DNS server failed: %v", err)
+			}
+		}()
+	}
+
+	if *kubeSync {
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			log.Fatalf("Failed to load Kubernetes config: %v", err)
+		}
+		go func() {
+			err := kubesync.Run(ctx, cfg, reg, kubesync.Options{Namespace: *kubeNamespace, ExportNamespace: *kubeExport})
+			if err != nil {
+				log.Fatalf("Kubernetes sync failed: %v", err)
+			}
+		}()
+	}
+
+	handler := reg.Handler()
+	if *auth {
+		handler = registry.AuthMiddleware(handler)
+	}
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: handler,
+	}
+	if *clientCA != "" {
+		pem, err := os.ReadFile(*clientCA)
+		if err != nil {
+			log.Fatalf("Failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates found in %s", *clientCA)
+		}
+		// Certificates are optional so that token holders can still connect;
+		// the policy decides what each caller may do.
+		srv.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+
+	go func() {
+		log.Printf("Starting registry on %s", *addr)
+		var err error
+		if *tlsCert != "" {
+			err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatalf("Registry server failed: %v", err)
+		}
+	}()
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down registry server...")
+	cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+	srv.Shutdown(shutdownCtx)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return d
+}
+
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return n
+}
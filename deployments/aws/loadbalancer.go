@@ -1,37 +1,166 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"io/fs"
 	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
-)
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-// Service backends (Kubernetes service DNS names)
-var (
-	userBackends    = []string{"http://user-service:8080"}
-	productBackends = []string{"http://product-service:8081"}
-	orderBackends   = []string{"http://order-service:8082"}
-	paymentBackends = []string{"http://payment-service:8083"}
+	"github.com/moodykhalif23/scalebit/internal/pkg/loadbalancer"
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
 )
 
+// defaultConfig is used when there is no config file: the core services at
+// their Kubernetes service DNS names.
+var defaultConfig = loadbalancer.Config{
+	Listen: ":9000",
+	Admin:  "127.0.0.1:9001",
+	Routes: []loadbalancer.RouteConfig{
+		{Prefix: "/users", Backends: []loadbalancer.BackendConfig{{URL: "http://user-service:8080"}}},
+		{Prefix: "/products", Backends: []loadbalancer.BackendConfig{{URL: "http://product-service:8081"}}},
+		{Prefix: "/orders", Strategy: loadbalancer.StrategyLeastConnections, Backends: []loadbalancer.BackendConfig{{URL: "http://order-service:8082"}}},
+		{Prefix: "/payments", Strategy: loadbalancer.StrategyLeastConnections, Backends: []loadbalancer.BackendConfig{{URL: "http://payment-service:8083"}}},
+	},
+}
+
 func main() {
-	http.HandleFunc("/users", makeProxyHandler(userBackends))
-	http.HandleFunc("/products", makeProxyHandler(productBackends))
-	http.HandleFunc("/orders", makeProxyHandler(orderBackends))
-	http.HandleFunc("/payments", makeProxyHandler(paymentBackends))
+	configPath := flag.String("config", envOr("LB_CONFIG", "loadbalancer.yaml"), "YAML or JSON config file; reloaded on change and on SIGHUP")
+	flag.Parse()
+	explicit := os.Getenv("LB_CONFIG") != ""
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+
+	cfg, err := loadbalancer.LoadConfig(*configPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+		log.Printf("No %s, using the built-in routes", *configPath)
+		cfg, *configPath = &defaultConfig, ""
+	case err != nil:
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := telemetry.RegisterLoadBalancerMetrics(prometheus.DefaultRegisterer); err != nil {
+		log.Fatalf("Failed to register metrics: %v", err)
+	}
+	if err := telemetry.InitMetrics(otel.GetMeterProvider().Meter("loadbalancer")); err != nil {
+		log.Fatalf("Failed to init metrics: %v", err)
+	}
+	router := loadbalancer.NewRouter()
+	defer router.Close()
+	if err := router.Load(cfg); err != nil {
+		log.Fatalf("Failed to load routes: %v", err)
+	}
+	var tlsTerm *loadbalancer.TLS
+	if cfg.TLS != nil {
+		if tlsTerm, err = loadbalancer.NewTLS(cfg.TLS); err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+	}
+
+	reload := func() {
+		cfg, err := loadbalancer.LoadConfig(*configPath)
+		if err == nil {
+			err = router.Load(cfg)
+		}
+		if err != nil {
+			log.Printf("Keeping the current routes, reload failed: %v", err)
+			return
+		}
+		if (tlsTerm != nil) != (cfg.TLS != nil) {
+			log.Printf("Turning TLS on or off takes a restart")
+		} else if tlsTerm != nil {
+			if err := tlsTerm.Reload(cfg.TLS); err != nil {
+				log.Printf("Keeping the current certificates, reload failed: %v", err)
+			}
+		}
+		log.Printf("Reloaded %s", *configPath)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *configPath != "" {
+		if err := loadbalancer.WatchFile(ctx, *configPath, reload); err != nil {
+			log.Printf("Not watching %s, reload with SIGHUP: %v", *configPath, err)
+		}
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				reload()
+			}
+		}()
+	}
+
+	var admin *http.Server
+	if cfg.Admin != "" {
+		admin = cfg.NewServer(cfg.Admin, router.AdminHandler())
+		log.Printf("Serving the admin API on %s", cfg.Admin)
+		go serve(admin.ListenAndServe)
+	}
 
-	log.Println("Starting Load Balancer on :9000")
-	log.Fatal(http.ListenAndServe(":9000", nil))
+	addr := cfg.Listen
+	if addr == "" {
+		addr = ":9000"
+	}
+	srv := cfg.NewServer(addr, telemetry.Middleware(router))
+	public := []*http.Server{srv}
+	if tlsTerm == nil {
+		log.Printf("Starting Load Balancer on %s", addr)
+		go serve(srv.ListenAndServe)
+	} else {
+		if cfg.TLS.RedirectHTTP != "" {
+			redirect := cfg.NewServer(cfg.TLS.RedirectHTTP, tlsTerm.RedirectHandler(addr))
+			public = append(public, redirect)
+			log.Printf("Redirecting HTTP on %s to HTTPS", cfg.TLS.RedirectHTTP)
+			go serve(redirect.ListenAndServe)
+		}
+		srv.TLSConfig = tlsTerm.Config()
+		log.Printf("Starting Load Balancer with TLS on %s", addr)
+		go serve(func() error { return srv.ListenAndServeTLS("", "") })
+	}
+
+	// Graceful shutdown: stop accepting, then let requests in flight finish.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	timeout := time.Duration(cfg.ServerSettings().ShutdownTimeout)
+	log.Printf("Shutting down Load Balancer, waiting up to %s for requests in flight", timeout)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeout)
+	defer shutdownCancel()
+	var wg sync.WaitGroup
+	for _, s := range public {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Shutting down %s: %v", s.Addr, err)
+			}
+		}()
+	}
+	wg.Wait()
+	// The admin API stays up until the end, so the drain can be watched.
+	if admin != nil {
+		admin.Shutdown(shutdownCtx)
+	}
+	log.Println("Load Balancer stopped")
 }
 
-func makeProxyHandler(backends []string) http.HandlerFunc {
-	proxies := make([]*httputil.ReverseProxy, len(backends))
-	for i, backend := range backends {
-		u, _ := url.Parse(backend)
-		proxies[i] = httputil.NewSingleHostReverseProxy(u)
+func serve(listen func() error) {
+	if err := listen(); err != http.ErrServerClosed {
+		log.Fatalf("Server failed: %v", err)
 	}
-	return func(w http.ResponseWriter, r *http.Request) {
-		proxies[0].ServeHTTP(w, r)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
+	return def
 }
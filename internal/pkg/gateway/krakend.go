@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/moodykhalif23/scalebit/api/v1alpha1"
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+)
+
+// Settings are the gateway-wide values that are not derived from services.
+type Settings struct {
+	Port         int      `json:"port,omitempty"`
+	Alg          string   `json:"alg,omitempty"`
+	JWKLocalPath string   `json:"jwkLocalPath,omitempty"`
+	RolesKey     string   `json:"rolesKey,omitempty"`
+	AllowOrigins []string `json:"allowOrigins,omitempty"`
+	MaxRate      int      `json:"maxRate,omitempty"`
+	Capacity     int      `json:"capacity,omitempty"`
+	// PropagateClaims applies to services whose Microservice does not set
+	// spec.gateway.propagateClaims.
+	PropagateClaims []v1alpha1.ClaimHeader `json:"propagateClaims,omitempty"`
+}
+
+// DefaultSettings match the values the gateway has been deployed with.
+func DefaultSettings() Settings {
+	return Settings{
+		Port:         80,
+		Alg:          "HS256",
+		JWKLocalPath: "/etc/krakend/symmetric.jwk",
+		RolesKey:     "role",
+		AllowOrigins: []string{"*"},
+		MaxRate:      100,
+		Capacity:     200,
+		PropagateClaims: []v1alpha1.ClaimHeader{
+			{Claim: "id", Header: "x-user-id"},
+			{Claim: "role", Header: "x-user-role"},
+			{Claim: "email", Header: "x-user-email"},
+		},
+	}
+}
+
+// Merge returns s with every unset field taken from defaults.
+func (s Settings) Merge(defaults Settings) Settings {
+	if s.Port == 0 {
+		s.Port = defaults.Port
+	}
+	if s.Alg == "" {
+		s.Alg = defaults.Alg
+	}
+	if s.JWKLocalPath == "" {
+		s.JWKLocalPath = defaults.JWKLocalPath
+	}
+	if s.RolesKey == "" {
+		s.RolesKey = defaults.RolesKey
+	}
+	if s.AllowOrigins == nil {
+		s.AllowOrigins = defaults.AllowOrigins
+	}
+	if s.MaxRate == 0 {
+		s.MaxRate = defaults.MaxRate
+	}
+	if s.Capacity == 0 {
+		s.Capacity = defaults.Capacity
+	}
+	if s.PropagateClaims == nil {
+		s.PropagateClaims = defaults.PropagateClaims
+	}
+	return s
+}
+
+// Service pairs a Microservice resource with the OpenAPI document of the
+// workload it deploys.
+type Service struct {
+	Microservice v1alpha1.Microservice
+	Spec         *openapi.Document
+}
+
+type config struct {
+	Version     int                    `json:"version"`
+	Port        int                    `json:"port"`
+	Endpoints   []endpoint             `json:"endpoints"`
+	ExtraConfig map[string]interface{} `json:"extra_config"`
+}
+
+type endpoint struct {
+	Endpoint    string                 `json:"endpoint"`
+	Method      string                 `json:"method"`
+	Backend     []backend              `json:"backend"`
+	ExtraConfig map[string]interface{} `json:"extra_config,omitempty"`
+}
+
+type backend struct {
+	URLPattern    string                 `json:"url_pattern"`
+	Host          []string               `json:"host"`
+	HeadersToPass []string               `json:"headers_to_pass,omitempty"`
+	ExtraConfig   map[string]interface{} `json:"extra_config,omitempty"`
+}
+
+type validator struct {
+	Alg                string     `json:"alg"`
+	JWKLocalPath       string     `json:"jwk_local_path"`
+	DisableJWKSecurity bool       `json:"disable_jwk_security"`
+	RolesKey           string     `json:"roles_key"`
+	Roles              []string   `json:"roles,omitempty"`
+	PropagateClaims    [][]string `json:"propagate_claims,omitempty"`
+}
+
+var methodOrder = map[string]int{"get": 0, "post": 1, "put": 2, "patch": 3, "delete": 4}
+
+// KrakenD renders the KrakenD configuration for services. Endpoints are
+// grouped by service in the given order, then sorted by path and method, so
+// the output is stable enough to commit and check.
+func KrakenD(settings Settings, services []Service) ([]byte, error) {
+	cfg := config{
+		Version:   3,
+		Port:      settings.Port,
+		Endpoints: []endpoint{},
+		ExtraConfig: map[string]interface{}{
+			"security/cors": map[string]interface{}{
+				"allow_origins":     settings.AllowOrigins,
+				"allow_methods":     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+				"allow_headers":     []string{"Authorization", "Content-Type", "Origin", "Accept"},
+				"expose_headers":    []string{"Content-Length"},
+				"max_age":           "12h",
+				"allow_credentials": true,
+			},
+			"router": map[string]interface{}{
+				"auto_options":     true,
+				"return_error_msg": true,
+			},
+			"github.com/devopsfaith/krakend-ratelimit/juju/router": map[string]interface{}{
+				"max_rate": settings.MaxRate,
+				"capacity": settings.Capacity,
+			},
+		},
+	}
+
+	for _, svc := range services {
+		ms := svc.Microservice
+		if svc.Spec == nil {
+			return nil, fmt.Errorf("gateway: no OpenAPI document for %s", ms.Name)
+		}
+		if ms.Spec.Port == 0 {
+			return nil, fmt.Errorf("gateway: Microservice %s has no port", ms.Name)
+		}
+		host := fmt.Sprintf("http://%s:%d", ms.Name, ms.Spec.Port)
+
+		claims := settings.PropagateClaims
+		var serviceRoles []string
+		if gw := ms.Spec.Gateway; gw != nil {
+			if gw.PropagateClaims != nil {
+				claims = gw.PropagateClaims
+			}
+			serviceRoles = gw.Roles
+		}
+
+		paths := make([]string, 0, len(svc.Spec.Paths))
+		for p := range svc.Spec.Paths {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			item := svc.Spec.Paths[p]
+			methods := make([]string, 0, len(item))
+			for m := range item {
+				methods = append(methods, m)
+			}
+			sort.Slice(methods, func(i, j int) bool { return methodOrder[methods[i]] < methodOrder[methods[j]] })
+
+			for _, m := range methods {
+				op := item[m]
+				if op.Internal {
+					continue
+				}
+				ep := endpoint{
+					Endpoint: p,
+					Method:   strings.ToUpper(m),
+					Backend:  []backend{{URLPattern: p, Host: []string{host}}},
+				}
+				if op.Security != nil && len(*op.Security) == 0 {
+					// Public operation: let the service's own status codes through.
+					ep.Backend[0].ExtraConfig = map[string]interface{}{
+						"backend/http": map[string]interface{}{"return_error_code": true},
+					}
+				} else {
+					ep.Backend[0].HeadersToPass = []string{"Authorization"}
+					v := validator{
+						Alg:          settings.Alg,
+						JWKLocalPath: settings.JWKLocalPath,
+						RolesKey:     settings.RolesKey,
+						Roles:        mergeRoles(serviceRoles, op.Roles),
+					}
+					for _, c := range claims {
+						v.PropagateClaims = append(v.PropagateClaims, []string{c.Claim, c.Header})
+					}
+					ep.ExtraConfig = map[string]interface{}{"auth/validator": v}
+				}
+				cfg.Endpoints = append(cfg.Endpoints, ep)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func mergeRoles(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, r := range append(append([]string{}, a...), b...) {
+		if !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
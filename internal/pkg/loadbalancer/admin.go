@@ -0,0 +1,199 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// AdminHandler returns the admin API, meant for a separate, internal
+// listener:
+//
+//	GET  /routes            routes with the state of their backends
+//	GET  /breakers          circuit breaker state of every backend
+//	POST /backends/drain    keep a backend from new requests
+//	POST /backends/undrain  let it have them again
+//	POST /backends/weight   change a backend's weight
+//	POST /cache/purge       drop cached responses
+//	GET  /metrics           Prometheus metrics
+//
+// The backend endpoints take the route prefix, or prefix@split for the
+// backends of a split, and the backend URL as route and backend parameters,
+// and /backends/weight the new weight. /cache/purge takes an optional route
+// prefix and path, and drops the responses of that route, or of all, for
+// the path and below it, or for all paths.
+func (rt *Router) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /routes", rt.routesHandler)
+	mux.HandleFunc("GET /breakers", rt.breakersHandler)
+	mux.HandleFunc("POST /backends/drain", rt.drainHandler(true))
+	mux.HandleFunc("POST /backends/undrain", rt.drainHandler(false))
+	mux.HandleFunc("POST /backends/weight", rt.weightHandler)
+	mux.HandleFunc("POST /cache/purge", rt.purgeHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	return mux
+}
+
+type routeStatus struct {
+	Prefix   string          `json:"prefix"`
+	Rewrite  string          `json:"rewrite,omitempty"`
+	Strategy string          `json:"strategy"`
+	Service  string          `json:"service,omitempty"`
+	Backends []backendStatus `json:"backends"`
+	Splits   []splitStatus   `json:"splits,omitempty"`
+}
+
+type splitStatus struct {
+	Name     string            `json:"name"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+	Roles    []string          `json:"roles,omitempty"`
+	Percent  *int              `json:"percent,omitempty"`
+	Backends []backendStatus   `json:"backends"`
+}
+
+type backendStatus struct {
+	URL          string     `json:"url"`
+	Weight       int        `json:"weight"`
+	Available    bool       `json:"available"`
+	Healthy      bool       `json:"healthy"`
+	EjectedUntil *time.Time `json:"ejectedUntil,omitempty"`
+	Breaker      string     `json:"breaker"`
+	Draining     bool       `json:"draining"`
+	InFlight     int64      `json:"inFlight"`
+}
+
+func (rt *Router) routesHandler(w http.ResponseWriter, req *http.Request) {
+	out := []routeStatus{}
+	for _, r := range rt.table.Load().routes {
+		s := routeStatus{Prefix: r.prefix, Rewrite: r.rewrite, Strategy: r.strategy, Service: r.service, Backends: []backendStatus{}}
+		for _, b := range r.pool.Backends() {
+			s.Backends = append(s.Backends, statusOf(b))
+		}
+		for _, sp := range r.splits {
+			ss := splitStatus{Name: sp.name, Headers: sp.headers, Cookies: sp.cookies, Roles: sp.roles, Backends: []backendStatus{}}
+			if sp.percent {
+				percent := sp.hi - sp.lo
+				ss.Percent = &percent
+			}
+			for _, b := range sp.pool.Backends() {
+				ss.Backends = append(ss.Backends, statusOf(b))
+			}
+			s.Splits = append(s.Splits, ss)
+		}
+		out = append(out, s)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func statusOf(b *Backend) backendStatus {
+	breaker, _ := b.BreakerState()
+	s := backendStatus{
+		URL:       b.URL.String(),
+		Weight:    b.Weight(),
+		Available: b.Available(),
+		Healthy:   b.Healthy(),
+		Breaker:   breaker,
+		Draining:  b.Draining(),
+		InFlight:  b.InFlight(),
+	}
+	if until := b.EjectedUntil(); until.After(time.Now()) {
+		s.EjectedUntil = &until
+	}
+	return s
+}
+
+func (rt *Router) drainHandler(draining bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		b, ok := rt.backendParam(w, req)
+		if !ok {
+			return
+		}
+		b.SetDraining(draining)
+		writeJSON(w, http.StatusOK, statusOf(b))
+	}
+}
+
+func (rt *Router) weightHandler(w http.ResponseWriter, req *http.Request) {
+	weight, err := strconv.Atoi(req.FormValue("weight"))
+	if err != nil || weight < 1 {
+		http.Error(w, "weight must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	b, ok := rt.backendParam(w, req)
+	if !ok {
+		return
+	}
+	b.SetWeight(weight)
+	log.Printf("Backend %s weight set to %d", b.URL, weight)
+	writeJSON(w, http.StatusOK, statusOf(b))
+}
+
+// backendParam finds the backend named by the route and backend parameters,
+// answering 400 or 404 if there is none.
+func (rt *Router) backendParam(w http.ResponseWriter, req *http.Request) (*Backend, bool) {
+	prefix, rawURL := req.FormValue("route"), req.FormValue("backend")
+	if prefix == "" || rawURL == "" {
+		http.Error(w, "route and backend are required", http.StatusBadRequest)
+		return nil, false
+	}
+	p := rt.table.Load().pool(prefix)
+	if p == nil {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return nil, false
+	}
+	for _, b := range p.Backends() {
+		if b.URL.String() == rawURL {
+			return b, true
+		}
+	}
+	http.Error(w, "Backend not found", http.StatusNotFound)
+	return nil, false
+}
+
+func (rt *Router) purgeHandler(w http.ResponseWriter, req *http.Request) {
+	route, path := req.FormValue("route"), req.FormValue("path")
+	rt.mu.Lock()
+	cache := rt.cache
+	rt.mu.Unlock()
+	n := 0
+	if cache != nil {
+		n = cache.Purge(route, path)
+	}
+	log.Printf("Purged %d cached responses (route %q, path %q)", n, route, path)
+	writeJSON(w, http.StatusOK, map[string]int{"purged": n})
+}
+
+type breakerStatus struct {
+	Route   string     `json:"route"`
+	Backend string     `json:"backend"`
+	State   string     `json:"state"`
+	RetryAt *time.Time `json:"retryAt,omitempty"`
+}
+
+func (rt *Router) breakersHandler(w http.ResponseWriter, req *http.Request) {
+	out := []breakerStatus{}
+	for _, r := range rt.table.Load().routes {
+		for _, p := range r.pools() {
+			for _, b := range p.Backends() {
+				state, until := b.BreakerState()
+				s := breakerStatus{Route: p.name, Backend: b.URL.String(), State: state}
+				if !until.IsZero() {
+					s.RetryAt = &until
+				}
+				out = append(out, s)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,144 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// postForm posts form to path of the admin API and decodes the JSON answer
+// into out, if the request succeeded.
+func postForm(t *testing.T, srv *httptest.Server, path string, form url.Values, out interface{}) int {
+	t.Helper()
+	resp, err := http.PostForm(srv.URL+path, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAdminBackends(t *testing.T) {
+	products := static("/products", SplitConfig{
+		Name:     "canary",
+		Headers:  map[string]string{"X-Canary": ""},
+		Backends: []BackendConfig{{URL: "http://10.0.0.2:8080"}},
+	})
+	rt := newTestRouter(t, &Config{Routes: []RouteConfig{products}})
+	srv := httptest.NewServer(rt.AdminHandler())
+	defer srv.Close()
+	backend := func(pool string) *Backend {
+		return rt.table.Load().pool(pool).Backends()[0]
+	}
+	params := func(kv ...string) url.Values {
+		v := url.Values{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			v.Set(kv[i], kv[i+1])
+		}
+		return v
+	}
+
+	var status backendStatus
+	if code := postForm(t, srv, "/backends/drain", params("route", "/products", "backend", "http://10.0.0.1:8080"), &status); code != http.StatusOK || !status.Draining {
+		t.Fatalf("drain: %d, %+v", code, status)
+	}
+	if !backend("/products").Draining() || backend("/products@canary").Draining() {
+		t.Error("drain did not drain only the route's backend")
+	}
+	if code := postForm(t, srv, "/backends/undrain", params("route", "/products", "backend", "http://10.0.0.1:8080"), &status); code != http.StatusOK || status.Draining || backend("/products").Draining() {
+		t.Errorf("undrain: %d, %+v", code, status)
+	}
+
+	// prefix@split names the backends of a split.
+	if code := postForm(t, srv, "/backends/weight", params("route", "/products@canary", "backend", "http://10.0.0.2:8080", "weight", "7"), &status); code != http.StatusOK || status.Weight != 7 {
+		t.Errorf("weight: %d, %+v", code, status)
+	}
+	if backend("/products@canary").Weight() != 7 || backend("/products").Weight() != 1 {
+		t.Error("the weight was not set on the split's backend alone")
+	}
+
+	for _, tt := range []struct {
+		name string
+		path string
+		form url.Values
+		want int
+	}{
+		{"weight 0", "/backends/weight", params("route", "/products", "backend", "http://10.0.0.1:8080", "weight", "0"), http.StatusBadRequest},
+		{"negative weight", "/backends/weight", params("route", "/products", "backend", "http://10.0.0.1:8080", "weight", "-2"), http.StatusBadRequest},
+		{"weight not a number", "/backends/weight", params("route", "/products", "backend", "http://10.0.0.1:8080", "weight", "heavy"), http.StatusBadRequest},
+		{"no backend", "/backends/drain", params("route", "/products"), http.StatusBadRequest},
+		{"unknown route", "/backends/drain", params("route", "/orders", "backend", "http://10.0.0.1:8080"), http.StatusNotFound},
+		{"unknown split", "/backends/drain", params("route", "/products@beta", "backend", "http://10.0.0.2:8080"), http.StatusNotFound},
+		{"backend of another pool", "/backends/drain", params("route", "/products", "backend", "http://10.0.0.2:8080"), http.StatusNotFound},
+	} {
+		if code := postForm(t, srv, tt.path, tt.form, nil); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+	if backend("/products").Weight() != 1 || backend("/products").Draining() {
+		t.Error("a rejected request changed the backend")
+	}
+}
+
+func TestAdminCachePurge(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer origin.Close()
+	route := func(prefix string) RouteConfig {
+		rc := static(prefix)
+		rc.Backends = []BackendConfig{{URL: origin.URL}}
+		rc.Cache = &RouteCacheConfig{}
+		return rc
+	}
+	rt := newTestRouter(t, &Config{Routes: []RouteConfig{route("/products"), route("/reviews")}})
+	srv := httptest.NewServer(rt.AdminHandler())
+	defer srv.Close()
+	fetch := func(path string) string {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header().Get("X-Cache")
+	}
+	paths := []string{"/products/1", "/products/2", "/products/2/images", "/reviews/1"}
+	fill := func() {
+		for _, p := range paths {
+			fetch(p)
+		}
+	}
+	cached := func() (n int) {
+		for _, p := range paths {
+			if fetch(p) == cacheHit {
+				n++
+			}
+		}
+		return n
+	}
+
+	for _, tt := range []struct {
+		name  string
+		form  url.Values
+		purge int
+	}{
+		{"a path and below", url.Values{"route": {"/products"}, "path": {"/products/2"}}, 2},
+		{"a route", url.Values{"route": {"/products"}}, 3},
+		{"another route", url.Values{"route": {"/orders"}}, 0},
+		{"everything", nil, 4},
+	} {
+		fill()
+		var out map[string]int
+		if code := postForm(t, srv, "/cache/purge", tt.form, &out); code != http.StatusOK || out["purged"] != tt.purge {
+			t.Errorf("purge %s: %d, %v; want %d purged", tt.name, code, out, tt.purge)
+		}
+		if n := cached(); n != len(paths)-tt.purge {
+			t.Errorf("purge %s left %d of %d responses cached, want %d", tt.name, n, len(paths), len(paths)-tt.purge)
+		}
+	}
+}
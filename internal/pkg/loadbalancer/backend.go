@@ -0,0 +1,167 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+)
+
+// Backend is one upstream server of a pool.
+type Backend struct {
+	URL *url.URL
+
+	weight     atomic.Int64
+	configured int // weight given to NewBackend
+	draining   atomic.Bool
+
+	proxy     *httputil.ReverseProxy
+	transport http.RoundTripper
+	inFlight  atomic.Int64
+	health    health
+	outlier   atomic.Pointer[OutlierDetection] // set by the pool; nil disables it
+	breaker   breaker
+}
+
+// NewBackend parses rawURL, e.g. "http://user-service:8080". Requests are
+// sent with transport, or http.DefaultTransport if it is nil.
+func NewBackend(rawURL string, weight int, transport http.RoundTripper) (*Backend, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend %q: %w", rawURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid backend %q: want scheme://host[:port]", rawURL)
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	b := &Backend{
+		URL:        u,
+		configured: max(weight, 1),
+		proxy:      httputil.NewSingleHostReverseProxy(u),
+		transport:  transport,
+	}
+	b.weight.Store(int64(b.configured))
+	b.proxy.Transport = transport
+	director := b.proxy.Director
+	b.proxy.Director = func(r *http.Request) {
+		director(r)
+		// Backends cannot tell otherwise that the client used HTTPS.
+		if r.TLS != nil {
+			r.Header.Set("X-Forwarded-Proto", "https")
+		} else {
+			r.Header.Set("X-Forwarded-Proto", "http")
+		}
+	}
+	b.proxy.ModifyResponse = func(resp *http.Response) error {
+		failed := resp.StatusCode >= 500
+		b.record(failed)
+		if up, ok := resp.Request.Context().Value(upstreamKey{}).(upstream); ok {
+			elapsed := time.Since(up.start)
+			b.recordBreaker(failed, elapsed)
+			telemetry.LoadBalancerUpstreamResponses.WithLabelValues(up.route, b.URL.String(), strconv.Itoa(resp.StatusCode)).Inc()
+			telemetry.LoadBalancerUpstreamDuration.WithLabelValues(up.route, b.URL.String()).Observe(elapsed.Seconds())
+		}
+		return nil
+	}
+	b.proxy.ErrorHandler = b.handleError
+	return b, nil
+}
+
+// Weight is the backend's relative share of traffic; at least 1.
+func (b *Backend) Weight() int {
+	return int(b.weight.Load())
+}
+
+// SetWeight changes the backend's weight until it is replaced, e.g. by a
+// reload that changes its configured weight.
+func (b *Backend) SetWeight(weight int) {
+	b.weight.Store(int64(max(weight, 1)))
+}
+
+// Draining reports whether the backend is kept from new requests.
+func (b *Backend) Draining() bool {
+	return b.draining.Load()
+}
+
+// SetDraining keeps the backend from new requests, or lets it have them
+// again. Requests in flight are not affected.
+func (b *Backend) SetDraining(draining bool) {
+	if b.draining.Swap(draining) != draining {
+		log.Printf("Backend %s draining: %t", b.URL, draining)
+	}
+}
+
+// InFlight is the number of requests currently proxied to the backend.
+func (b *Backend) InFlight() int64 {
+	return b.inFlight.Load()
+}
+
+// load is the in-flight count relative to the backend's weight.
+func (b *Backend) load() float64 {
+	return float64(b.inFlight.Load()) / float64(b.Weight())
+}
+
+type upstreamKey struct{}
+
+// upstream is what ModifyResponse and handleError need to know about the
+// request they handle.
+type upstream struct {
+	route string
+	start time.Time
+}
+
+// serve proxies r to the backend for route. gen is the breaker's trial
+// slot from acquire, released when the request is done.
+func (b *Backend) serve(w http.ResponseWriter, r *http.Request, route string, gen uint64) {
+	b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	defer b.release(gen)
+	r = r.WithContext(context.WithValue(r.Context(), upstreamKey{}, upstream{route, time.Now()}))
+	b.proxy.ServeHTTP(w, r)
+}
+
+// handleError is called when the backend could not be reached or did not
+// answer in time. Nothing has been written to w yet, so a retryable request
+// is resent to another backend of the pool.
+func (b *Backend) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		// The client went away; not the backend's fault.
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		// Neither is a body over the route's cap.
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	b.record(true)
+	b.recordBreaker(true, 0)
+	if up, ok := r.Context().Value(upstreamKey{}).(upstream); ok {
+		telemetry.LoadBalancerUpstreamErrors.WithLabelValues(up.route, b.URL.String()).Inc()
+	}
+	log.Printf("Proxying %s %s to %s: %v", r.Method, r.URL.Path, b.URL, err)
+	if a, ok := r.Context().Value(attemptKey{}).(*attempt); ok {
+		if next, gen := a.next(); next != nil {
+			next.serve(w, a.req, a.pool.name, gen)
+			return
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		return
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
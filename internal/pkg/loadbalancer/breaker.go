@@ -0,0 +1,202 @@
+package loadbalancer
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker configures the breaker in front of every backend of a pool.
+// A closed breaker lets requests through and opens after FailureThreshold
+// failures in a row; a failure is a connection error, a 5xx or, with
+// SlowThreshold set, a response that took longer. An open breaker rejects
+// requests until CoolDown has passed and then half-opens: up to
+// HalfOpenRequests trial requests go through at a time, SuccessThreshold
+// successes close it and any failure opens it again.
+type CircuitBreaker struct {
+	FailureThreshold int
+	SlowThreshold    time.Duration
+	CoolDown         time.Duration
+	HalfOpenRequests int
+	SuccessThreshold int
+}
+
+// DefaultCircuitBreaker opens after 10 failures in a row, counting responses
+// slower than 10 seconds, and tries again after 15 seconds.
+var DefaultCircuitBreaker = CircuitBreaker{
+	FailureThreshold: 10,
+	SlowThreshold:    10 * time.Second,
+	CoolDown:         15 * time.Second,
+	HalfOpenRequests: 1,
+	SuccessThreshold: 2,
+}
+
+// breaker is the circuit breaker state of one backend.
+type breaker struct {
+	mu        sync.Mutex
+	config    *CircuitBreaker // nil disables the breaker
+	route     string          // for metrics
+	state     string
+	failures  int
+	successes int
+	openUntil time.Time
+	trials    int
+	// gen changes with every state change, so that a trial request that
+	// finishes after it does not release a slot of the new half-open period.
+	gen uint64
+}
+
+// configure is called by the pool that owns the backend.
+func (b *Backend) configure(cb *CircuitBreaker, route string) {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.config, br.route = cb, route
+	if br.state == "" {
+		br.state = BreakerClosed
+	}
+	b.reportBreakerLocked()
+}
+
+// BreakerState returns the state of the backend's circuit breaker and, when
+// open, when it will half-open.
+func (b *Backend) BreakerState() (string, time.Time) {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.config == nil {
+		return BreakerClosed, time.Time{}
+	}
+	b.advanceLocked(time.Now())
+	if br.state == BreakerOpen {
+		return br.state, br.openUntil
+	}
+	return br.state, time.Time{}
+}
+
+// ready reports whether the breaker would let a request through now.
+func (b *Backend) ready() bool {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.config == nil {
+		return true
+	}
+	b.advanceLocked(time.Now())
+	switch br.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return br.trials < br.config.HalfOpenRequests
+	}
+	return true
+}
+
+// acquire lets one request through. In the half-open state it takes a trial
+// slot and returns its generation, to be passed to release; otherwise the
+// generation is 0.
+func (b *Backend) acquire() (gen uint64, ok bool) {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.config == nil {
+		return 0, true
+	}
+	b.advanceLocked(time.Now())
+	switch br.state {
+	case BreakerOpen:
+		return 0, false
+	case BreakerHalfOpen:
+		if br.trials >= br.config.HalfOpenRequests {
+			return 0, false
+		}
+		br.trials++
+		return br.gen, true
+	}
+	return 0, true
+}
+
+// release frees the trial slot taken by acquire.
+func (b *Backend) release(gen uint64) {
+	if gen == 0 {
+		return
+	}
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.gen == gen && br.trials > 0 {
+		br.trials--
+	}
+}
+
+// recordBreaker feeds the outcome of a request to the breaker.
+func (b *Backend) recordBreaker(failed bool, elapsed time.Duration) {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	cfg := br.config
+	if cfg == nil {
+		return
+	}
+	if cfg.SlowThreshold > 0 && elapsed > cfg.SlowThreshold {
+		failed = true
+	}
+	now := time.Now()
+	b.advanceLocked(now)
+	switch br.state {
+	case BreakerClosed:
+		if !failed {
+			br.failures = 0
+			return
+		}
+		br.failures++
+		if br.failures >= cfg.FailureThreshold {
+			b.setStateLocked(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.setStateLocked(BreakerOpen, now)
+			return
+		}
+		br.successes++
+		if br.successes >= cfg.SuccessThreshold {
+			b.setStateLocked(BreakerClosed, now)
+		}
+	}
+}
+
+// advanceLocked half-opens an open breaker whose cool-down is over.
+func (b *Backend) advanceLocked(now time.Time) {
+	if b.breaker.state == BreakerOpen && !now.Before(b.breaker.openUntil) {
+		b.setStateLocked(BreakerHalfOpen, now)
+	}
+}
+
+func (b *Backend) setStateLocked(state string, now time.Time) {
+	br := &b.breaker
+	br.state = state
+	br.failures, br.successes, br.trials = 0, 0, 0
+	br.gen++
+	if state == BreakerOpen {
+		br.openUntil = now.Add(br.config.CoolDown)
+		log.Printf("Circuit breaker of %s on %s opened for %s", b.URL, br.route, br.config.CoolDown)
+	} else {
+		log.Printf("Circuit breaker of %s on %s is %s", b.URL, br.route, state)
+	}
+	telemetry.LoadBalancerBreakerTransitions.WithLabelValues(br.route, b.URL.String(), state).Inc()
+	b.reportBreakerLocked()
+}
+
+func (b *Backend) reportBreakerLocked() {
+	value := map[string]float64{BreakerClosed: 0, BreakerHalfOpen: 1, BreakerOpen: 2}[b.breaker.state]
+	telemetry.LoadBalancerBreakerState.WithLabelValues(b.breaker.route, b.URL.String()).Set(value)
+}
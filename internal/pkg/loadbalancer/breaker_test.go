@@ -0,0 +1,118 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	var served atomic.Int32
+	failing.Store(true)
+	b := newServerBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		if failing.Load() {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	p := NewPool(&RoundRobin{}, []*Backend{b}, WithName("test"), WithCircuitBreaker(CircuitBreaker{
+		FailureThreshold: 3,
+		CoolDown:         100 * time.Millisecond,
+		HalfOpenRequests: 1,
+		SuccessThreshold: 2,
+	}))
+
+	for i := 0; i < 3; i++ {
+		if code := send(p, http.MethodGet, ""); code != http.StatusInternalServerError {
+			t.Fatalf("request %d answered %d before the breaker opened", i, code)
+		}
+	}
+	if state, _ := b.BreakerState(); state != BreakerOpen {
+		t.Fatalf("breaker is %s after 3 failures, want open", state)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); w.Code != http.StatusServiceUnavailable || retry < 1 {
+		t.Errorf("open breaker answered %d with Retry-After %q, want 503 at once", w.Code, w.Header().Get("Retry-After"))
+	}
+	if served.Load() != 3 {
+		t.Errorf("the backend got %d requests while the breaker was open", served.Load()-3)
+	}
+
+	// A failed trial request opens the breaker again.
+	time.Sleep(120 * time.Millisecond)
+	if state, _ := b.BreakerState(); state != BreakerHalfOpen {
+		t.Fatalf("breaker is %s after its cool-down, want half-open", state)
+	}
+	send(p, http.MethodGet, "")
+	if state, _ := b.BreakerState(); state != BreakerOpen {
+		t.Fatalf("breaker is %s after a failed trial, want open", state)
+	}
+
+	// Two successful trials close it.
+	failing.Store(false)
+	time.Sleep(120 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if code := send(p, http.MethodGet, ""); code != http.StatusOK {
+			t.Fatalf("trial %d answered %d", i, code)
+		}
+	}
+	if state, _ := b.BreakerState(); state != BreakerClosed {
+		t.Errorf("breaker is %s after 2 successful trials, want closed", state)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAdmitsOneTrial(t *testing.T) {
+	release := make(chan struct{})
+	var served atomic.Int32
+	b := newServerBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		<-release
+	}))
+	p := NewPool(&RoundRobin{}, []*Backend{b}, WithCircuitBreaker(CircuitBreaker{
+		FailureThreshold: 1,
+		CoolDown:         time.Millisecond,
+		HalfOpenRequests: 1,
+		SuccessThreshold: 1,
+	}))
+	b.recordBreaker(true, 0)
+	time.Sleep(5 * time.Millisecond)
+
+	trial := make(chan int)
+	go func() { trial <- send(p, http.MethodGet, "") }()
+	for served.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if code := send(p, http.MethodGet, ""); code != http.StatusServiceUnavailable {
+		t.Errorf("second request while a trial is in flight answered %d, want 503", code)
+	}
+	close(release)
+	if code := <-trial; code != http.StatusOK {
+		t.Errorf("trial answered %d", code)
+	}
+	if state, _ := b.BreakerState(); state != BreakerClosed {
+		t.Errorf("breaker is %s after a successful trial, want closed", state)
+	}
+}
+
+func TestCircuitBreakerCountsSlowResponses(t *testing.T) {
+	b := newServerBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	}))
+	p := NewPool(&RoundRobin{}, []*Backend{b}, WithCircuitBreaker(CircuitBreaker{
+		FailureThreshold: 2,
+		SlowThreshold:    10 * time.Millisecond,
+		CoolDown:         time.Minute,
+		HalfOpenRequests: 1,
+		SuccessThreshold: 1,
+	}))
+	send(p, http.MethodGet, "")
+	send(p, http.MethodGet, "")
+	if state, _ := b.BreakerState(); state != BreakerOpen {
+		t.Errorf("breaker is %s after 2 slow responses, want open", state)
+	}
+}
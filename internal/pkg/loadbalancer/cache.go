@@ -0,0 +1,526 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+)
+
+// Cache results, reported in the X-Cache header and metrics.
+const (
+	cacheHit         = "HIT"
+	cacheMiss        = "MISS"
+	cacheRevalidated = "REVALIDATED"
+	cacheCoalesced   = "COALESCED"
+	cacheBypass      = "BYPASS"
+)
+
+// Cache is an in-memory LRU of responses, bounded by their total size.
+type Cache struct {
+	maxBytes int64
+	maxEntry int64
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*list.Element // of *cacheEntry
+	lru     *list.List               // most recently used first
+	varies  map[string][]string      // request headers the responses of a URL vary by
+	calls   map[string]*cacheCall    // fetches in flight, for coalescing
+}
+
+// NewCache returns a cache holding up to maxBytes of responses of at most
+// maxEntry bytes each.
+func NewCache(maxBytes, maxEntry int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		maxEntry: min(maxEntry, maxBytes),
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		varies:   make(map[string][]string),
+		calls:    make(map[string]*cacheCall),
+	}
+}
+
+type cacheEntry struct {
+	key   string
+	route string
+	path  string
+
+	status       int
+	header       http.Header
+	body         []byte
+	stored       time.Time
+	age          time.Duration // Age the backend reported
+	lifetime     time.Duration // fresh until stored+lifetime-age
+	etag         string
+	lastModified string
+	size         int64
+}
+
+func (e *cacheEntry) currentAge(now time.Time) time.Duration {
+	return e.age + now.Sub(e.stored)
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return e.currentAge(now) < e.lifetime
+}
+
+// cacheCall is a fetch other requests for the same key wait for.
+type cacheCall struct {
+	done  chan struct{}
+	entry *cacheEntry // nil if the response could not be cached
+}
+
+func (c *Cache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry)
+}
+
+func (c *Cache) put(e *cacheEntry, vary []string, primary string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.varies[primary] = vary
+	if el, ok := c.entries[e.key]; ok {
+		c.removeLocked(el)
+	}
+	for c.size+e.size > c.maxBytes && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size
+	telemetry.LoadBalancerCacheBytes.Set(float64(c.size))
+}
+
+func (c *Cache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	telemetry.LoadBalancerCacheBytes.Set(float64(c.size))
+}
+
+// Purge drops the responses of route, or of every route if it is empty,
+// whose path is path or lies below it, or all of them if path is empty. It
+// returns how many were dropped.
+func (c *Cache) Purge(route, path string) int {
+	return c.purge(func(e *cacheEntry) bool {
+		return (route == "" || e.route == route) && (path == "" || matchPrefix(e.path, path))
+	})
+}
+
+// remove drops the entry stored under key, if any.
+func (c *Cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeLocked(el)
+	}
+}
+
+func (c *Cache) purge(match func(*cacheEntry) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if match(el.Value.(*cacheEntry)) {
+			c.removeLocked(el)
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+// key extends the primary key of a URL with the values of the request
+// headers its responses vary by.
+func (c *Cache) key(primary string, r *http.Request) string {
+	c.mu.Lock()
+	vary := c.varies[primary]
+	c.mu.Unlock()
+	return varyKey(primary, vary, r)
+}
+
+func varyKey(primary string, vary []string, r *http.Request) string {
+	if len(vary) == 0 {
+		return primary
+	}
+	var b strings.Builder
+	b.WriteString(primary)
+	for _, name := range vary {
+		b.WriteString("\x00" + name + "=" + strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// join returns the fetch in flight for key and false, or registers a new
+// one and returns true: the caller leads it and must call finish.
+func (c *Cache) join(key string) (*cacheCall, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call, ok := c.calls[key]; ok {
+		return call, false
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	return call, true
+}
+
+func (c *Cache) finish(key string, call *cacheCall) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// routeCache caches the GET responses of one route.
+type routeCache struct {
+	cache *Cache
+	route string
+	// ttl overrides the freshness the backend gives; 0 keeps it.
+	ttl time.Duration
+	// authorized caches the responses to requests with a verified JWT, per
+	// token subject.
+	authorized bool
+	secret     []byte
+}
+
+// serve answers r from the cache or through next, caching the response
+// when it may. pool names the backends next sends r to, so that splits
+// have their own entries.
+func (rc *routeCache) serve(w http.ResponseWriter, r *http.Request, pool string, next http.HandlerFunc) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// A successful change makes the cached responses of the path stale.
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+		if sw.status < 400 {
+			rc.cache.purge(func(e *cacheEntry) bool { return e.route == rc.route && e.path == r.URL.Path })
+		}
+		return
+	}
+	directives := cacheControl(r.Header.Values("Cache-Control"))
+	_, noStore := directives["no-store"]
+	auth := "-"
+	if r.Header.Get("Authorization") != "" {
+		// Authorized responses are only shared between the requests of one
+		// user.
+		auth = ""
+		if rc.authorized {
+			if sub := subject(bearerClaims(r, rc.secret)); sub != "" {
+				auth = "jwt:" + strconv.Quote(sub)
+			}
+		}
+		if auth == "" {
+			noStore = true
+		}
+	}
+	if noStore || r.Method == http.MethodHead || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		rc.count(cacheBypass)
+		w.Header().Set("X-Cache", cacheBypass)
+		next(w, r)
+		return
+	}
+
+	primary := strings.Join([]string{pool, auth, r.Host, r.URL.RequestURI()}, " ")
+	key := rc.cache.key(primary, r)
+	now := time.Now()
+	_, noCache := directives["no-cache"]
+	revalidate := noCache || directives["max-age"] == "0" || r.Header.Get("Pragma") == "no-cache"
+	stale := rc.cache.get(key)
+	if stale != nil && !revalidate && stale.fresh(now) {
+		rc.count(cacheHit)
+		serveEntry(w, r, stale, cacheHit, now)
+		return
+	}
+
+	call, leader := rc.cache.join(key)
+	if !leader {
+		select {
+		case <-call.done:
+		case <-r.Context().Done():
+			return
+		}
+		if call.entry != nil {
+			rc.count(cacheCoalesced)
+			serveEntry(w, r, call.entry, cacheCoalesced, time.Now())
+			return
+		}
+		rc.count(cacheMiss)
+		w.Header().Set("X-Cache", cacheMiss)
+		next(w, r)
+		return
+	}
+	defer rc.cache.finish(key, call)
+
+	// Ask for the whole response, or whether the stale one still holds; the
+	// client's own conditions are answered from the entry.
+	req := r.Clone(r.Context())
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	if stale != nil {
+		if stale.etag != "" {
+			req.Header.Set("If-None-Match", stale.etag)
+		}
+		if stale.lastModified != "" {
+			req.Header.Set("If-Modified-Since", stale.lastModified)
+		}
+	}
+	cw := &captureWriter{w: w, header: http.Header{}, limit: rc.cache.maxEntry}
+	next(cw, req)
+	if cw.passing {
+		// Too large to cache; it went straight to the client.
+		rc.count(cacheMiss)
+		return
+	}
+	now = time.Now()
+	if stale != nil && cw.status == http.StatusNotModified {
+		e := *stale
+		e.header = stale.header.Clone()
+		for name, values := range cw.header {
+			e.header[name] = values
+		}
+		if rc.entryFrom(&e, now) {
+			rc.cache.put(&e, varyOf(e.header), primary)
+			call.entry = &e
+		} else {
+			// The body still holds but may no longer be stored: serve it
+			// this once rather than the 304 meant for the cache.
+			rc.cache.remove(stale.key)
+			e.stored, e.age = now, 0
+		}
+		rc.count(cacheRevalidated)
+		serveEntry(w, r, &e, cacheRevalidated, now)
+		return
+	}
+	rc.count(cacheMiss)
+	e := &cacheEntry{key: key, route: rc.route, path: r.URL.Path, status: cw.status, header: cw.header, body: cw.body.Bytes()}
+	vary := varyOf(cw.header)
+	if storableStatus(cw.status) && !slices.Contains(vary, "*") && rc.entryFrom(e, now) {
+		// Requests waiting on key only share the entry if it varies by
+		// nothing they did not know about.
+		e.key = varyKey(primary, vary, r)
+		rc.cache.put(e, vary, primary)
+		if e.key == key {
+			call.entry = e
+		}
+		serveEntry(w, r, e, cacheMiss, now)
+		return
+	}
+	w.Header().Set("X-Cache", cacheMiss)
+	cw.flushTo(w)
+}
+
+// entryFrom fills in the freshness of e from its headers and reports
+// whether it may be stored.
+func (rc *routeCache) entryFrom(e *cacheEntry, now time.Time) bool {
+	h := e.header
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+	directives := cacheControl(h.Values("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if _, ok := directives["private"]; ok {
+		return false
+	}
+	e.etag, e.lastModified = h.Get("ETag"), h.Get("Last-Modified")
+	e.stored, e.age = now, 0
+	if secs, err := strconv.Atoi(h.Get("Age")); err == nil && secs > 0 {
+		e.age = time.Duration(secs) * time.Second
+	}
+	h.Del("Age")
+	h.Del("X-Cache")
+
+	e.lifetime = 0
+	_, noCache := directives["no-cache"]
+	switch {
+	case noCache:
+	case rc.ttl > 0:
+		e.lifetime = rc.ttl
+	case directives["s-maxage"] != "":
+		e.lifetime = seconds(directives["s-maxage"])
+	case directives["max-age"] != "":
+		e.lifetime = seconds(directives["max-age"])
+	case h.Get("Expires") != "":
+		expires, err := http.ParseTime(h.Get("Expires"))
+		date, err2 := http.ParseTime(h.Get("Date"))
+		if err2 != nil {
+			date = now
+		}
+		if err == nil {
+			e.lifetime = expires.Sub(date)
+		}
+	}
+	if e.lifetime <= 0 && e.etag == "" && e.lastModified == "" {
+		// Neither fresh nor revalidatable: caching it gains nothing.
+		return false
+	}
+	e.size = int64(len(e.key) + len(e.body) + 256)
+	for name, values := range h {
+		for _, v := range values {
+			e.size += int64(len(name) + len(v))
+		}
+	}
+	return e.size <= rc.cache.maxEntry
+}
+
+func (rc *routeCache) count(result string) {
+	telemetry.LoadBalancerCacheRequests.WithLabelValues(rc.route, strings.ToLower(result)).Inc()
+}
+
+// serveEntry writes e, or 304 when the client's copy is still current.
+func serveEntry(w http.ResponseWriter, r *http.Request, e *cacheEntry, result string, now time.Time) {
+	h := w.Header()
+	for name, values := range e.header {
+		h[name] = slices.Clone(values)
+	}
+	h.Set("Age", strconv.Itoa(int(e.currentAge(now).Seconds())))
+	h.Set("X-Cache", result)
+	if notModified(r, e) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// notModified evaluates the client's If-None-Match, or If-Modified-Since
+// without it, against e.
+func notModified(r *http.Request, e *cacheEntry) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if e.etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(e.etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || e.lastModified == "" {
+		return false
+	}
+	lm, err := http.ParseTime(e.lastModified)
+	return err == nil && !lm.After(ims)
+}
+
+// cacheControl parses Cache-Control header values into their directives.
+func cacheControl(values []string) map[string]string {
+	directives := map[string]string{}
+	for _, v := range values {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+func seconds(s string) time.Duration {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// varyOf returns the canonical names in the Vary header.
+func varyOf(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// storableStatus lists the status codes that are cacheable by default.
+func storableStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusPermanentRedirect,
+		http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// captureWriter buffers a response for the cache. A body outgrowing limit
+// is not cacheable: it is passed on to w as it comes instead.
+type captureWriter struct {
+	w       http.ResponseWriter
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+	limit   int64
+	passing bool
+}
+
+func (c *captureWriter) Header() http.Header {
+	if c.passing {
+		return c.w.Header()
+	}
+	return c.header
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.passing {
+		c.w.WriteHeader(code)
+		return
+	}
+	if c.status == 0 && code >= 200 {
+		c.status = code
+	}
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.passing && int64(c.body.Len()+len(p)) > c.limit {
+		c.w.Header().Set("X-Cache", cacheMiss)
+		c.flushTo(c.w)
+		c.passing = true
+	}
+	if c.passing {
+		return c.w.Write(p)
+	}
+	return c.body.Write(p)
+}
+
+// flushTo writes what was captured so far to w.
+func (c *captureWriter) flushTo(w http.ResponseWriter) {
+	h := w.Header()
+	for name, values := range c.header {
+		h[name] = values
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	w.WriteHeader(c.status)
+	w.Write(c.body.Bytes())
+	c.body.Reset()
+}
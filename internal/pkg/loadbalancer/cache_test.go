@@ -0,0 +1,124 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/moodykhalif23/scalebit/internal/pkg/security"
+)
+
+const testSecret = "test-secret"
+
+func newTestRouteCache(authorized bool) *routeCache {
+	return &routeCache{cache: NewCache(1<<20, 1<<16), route: "/products", authorized: authorized, secret: []byte(testSecret)}
+}
+
+// get sends a GET of /products through rc with the given headers.
+func get(rc *routeCache, next http.HandlerFunc, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/products", nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	rc.serve(w, r, "", next)
+	return w
+}
+
+func bearer(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = security.AudienceAPI
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+func TestCacheHit(t *testing.T) {
+	var calls atomic.Int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("catalogue"))
+	}
+	rc := newTestRouteCache(false)
+	for i, want := range []string{cacheMiss, cacheHit, cacheHit} {
+		w := get(rc, next)
+		if w.Header().Get("X-Cache") != want || w.Body.String() != "catalogue" {
+			t.Errorf("request %d: X-Cache %s, body %q; want %s", i, w.Header().Get("X-Cache"), w.Body, want)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("the backend got %d requests, want 1", calls.Load())
+	}
+}
+
+func TestCacheKeysAuthorizedResponsesBySubject(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}
+	alice := bearer(t, jwt.MapClaims{"id": 1, "role": "user"})
+	bob := bearer(t, jwt.MapClaims{"id": 2, "role": "user"})
+	carol := bearer(t, jwt.MapClaims{"sub": "carol"})
+	anonymous := bearer(t, jwt.MapClaims{"role": "user"})
+
+	rc := newTestRouteCache(true)
+	for i, tt := range []struct {
+		auth, want string
+	}{
+		{alice, cacheMiss},
+		{alice, cacheHit},
+		{bob, cacheMiss},
+		{bob, cacheHit},
+		{carol, cacheMiss},
+		{anonymous, cacheBypass},
+		{"Bearer forged", cacheBypass},
+	} {
+		w := get(rc, next, "Authorization", tt.auth)
+		if w.Header().Get("X-Cache") != tt.want {
+			t.Errorf("request %d: X-Cache %s, want %s", i, w.Header().Get("X-Cache"), tt.want)
+		}
+		if w.Body.String() != tt.auth {
+			t.Errorf("request %d got the response of another user", i)
+		}
+	}
+
+	rc = newTestRouteCache(false)
+	if w := get(rc, next, "Authorization", alice); w.Header().Get("X-Cache") != cacheBypass {
+		t.Errorf("route without authorized: X-Cache %s, want BYPASS", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheRevalidationThatCannotBeStored(t *testing.T) {
+	var conditional atomic.Int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			// Still current, but no longer to be stored.
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte("catalogue"))
+	}
+	rc := newTestRouteCache(false)
+	if w := get(rc, next); w.Code != http.StatusOK || w.Header().Get("X-Cache") != cacheMiss {
+		t.Fatalf("first request: %d, X-Cache %s", w.Code, w.Header().Get("X-Cache"))
+	}
+
+	w := get(rc, next)
+	if w.Code != http.StatusOK || w.Body.String() != "catalogue" || conditional.Load() != 1 {
+		t.Fatalf("revalidated request without validators got %d %q, want the body", w.Code, w.Body)
+	}
+	if w := get(rc, next); w.Header().Get("X-Cache") != cacheMiss || conditional.Load() != 1 {
+		t.Errorf("the unstorable entry was kept: X-Cache %s", w.Header().Get("X-Cache"))
+	}
+}
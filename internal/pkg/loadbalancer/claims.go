@@ -0,0 +1,48 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/moodykhalif23/scalebit/internal/pkg/security"
+)
+
+// bearerClaims returns the claims of the request's bearer token if it is
+// signed with secret and issued for the services, or nil. The load balancer
+// does not reject requests with bad tokens, the services do; it only uses
+// the claims to pick rate limits and backends.
+func bearerClaims(r *http.Request, secret []byte) jwt.MapClaims {
+	tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || len(secret) == 0 {
+		return nil
+	}
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return secret, nil
+	}, jwt.WithAudience(security.AudienceAPI))
+	if err != nil || !token.Valid {
+		return nil
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims
+}
+
+// subject identifies the user a token was issued to: its "sub" claim, or the
+// "id" claim of the user service's tokens. It is empty without either.
+func subject(claims jwt.MapClaims) string {
+	if sub, _ := claims["sub"].(string); sub != "" {
+		return sub
+	}
+	switch id := claims["id"].(type) {
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	case string:
+		return id
+	}
+	return ""
+}
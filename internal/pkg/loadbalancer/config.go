@@ -0,0 +1,715 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the layout of the load balancer's YAML or JSON config file.
+type Config struct {
+	// Listen is the address to serve on; only read at startup.
+	Listen string `json:"listen,omitempty"`
+	// Admin is the address of the admin API and metrics, e.g.
+	// "127.0.0.1:9001"; disabled if empty. Only read at startup.
+	Admin string `json:"admin,omitempty"`
+	// TLS serves HTTPS on Listen instead of plain HTTP. Only the
+	// certificate files and client CA are reread on reload.
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// Server overrides fields of DefaultServer; only maxBodyBytes is
+	// reread on reload.
+	Server *ServerConfig `json:"server,omitempty"`
+	// Upstream overrides fields of DefaultUpstream.
+	Upstream *UpstreamConfig `json:"upstream,omitempty"`
+	// Registry lists the service registry URLs used by routes with a
+	// service; REGISTRY_URL if empty.
+	Registry []string `json:"registry,omitempty"`
+	// RateLimitStore is where the rate limits of all routes keep their
+	// buckets; in memory by default.
+	RateLimitStore *RateLimitStoreConfig `json:"rateLimitStore,omitempty"`
+	// Cache overrides the sizes of DefaultCache, the response cache shared
+	// by the routes with a cache section.
+	Cache  *CacheConfig  `json:"cache,omitempty"`
+	Routes []RouteConfig `json:"routes"`
+}
+
+// ServerConfig holds the limits of the client-facing listeners.
+type ServerConfig struct {
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout,omitempty"`
+	ReadTimeout       Duration `json:"readTimeout,omitempty"`
+	WriteTimeout      Duration `json:"writeTimeout,omitempty"`
+	IdleTimeout       Duration `json:"idleTimeout,omitempty"`
+	MaxHeaderBytes    int      `json:"maxHeaderBytes,omitempty"`
+	// MaxBodyBytes caps request bodies of routes without their own cap.
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty"`
+	// ShutdownTimeout is how long SIGTERM waits for requests in flight.
+	ShutdownTimeout Duration `json:"shutdownTimeout,omitempty"`
+}
+
+// DefaultServer gives clients 10 seconds to send their headers and a minute
+// for the body. Responses, which may stream, and request bodies are not
+// limited.
+var DefaultServer = ServerConfig{
+	ReadHeaderTimeout: Duration(10 * time.Second),
+	ReadTimeout:       Duration(time.Minute),
+	IdleTimeout:       Duration(2 * time.Minute),
+	MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	ShutdownTimeout:   Duration(30 * time.Second),
+}
+
+// UpstreamConfig overrides fields of DefaultUpstream.
+type UpstreamConfig struct {
+	DialTimeout           Duration `json:"dialTimeout,omitempty"`
+	ResponseHeaderTimeout Duration `json:"responseHeaderTimeout,omitempty"`
+	IdleConnTimeout       Duration `json:"idleConnTimeout,omitempty"`
+	MaxIdleConns          int      `json:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost   int      `json:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost       int      `json:"maxConnsPerHost,omitempty"`
+}
+
+// CacheConfig sizes the response cache.
+type CacheConfig struct {
+	// MaxBytes bounds all cached responses together; the least recently
+	// used go first.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+	// MaxEntryBytes is the largest response that is cached.
+	MaxEntryBytes int64 `json:"maxEntryBytes,omitempty"`
+}
+
+// DefaultCache holds 64 MiB of responses of up to 1 MiB each.
+var DefaultCache = CacheConfig{
+	MaxBytes:      64 << 20,
+	MaxEntryBytes: 1 << 20,
+}
+
+// TLSConfig configures TLS termination.
+type TLSConfig struct {
+	// Certificates are picked by SNI; clients asking for a name none of them
+	// covers get the first one.
+	Certificates []CertificateConfig `json:"certificates,omitempty"`
+	// ACME obtains and renews certificates for more hosts automatically.
+	ACME *ACMEConfig `json:"acme,omitempty"`
+	// ClientCA is a PEM file of the CAs client certificates must be signed
+	// by; client certificates are not asked for if empty.
+	ClientCA string `json:"clientCA,omitempty"`
+	// ClientAuth is "require" (the default) or "optional", which only
+	// verifies the certificates clients do send.
+	ClientAuth string `json:"clientAuth,omitempty"`
+	// MinVersion is "1.2" (the default) or "1.3".
+	MinVersion string `json:"minVersion,omitempty"`
+	// RedirectHTTP is a plain HTTP address, e.g. ":80", that redirects to
+	// HTTPS and answers ACME HTTP-01 challenges.
+	RedirectHTTP string `json:"redirectHTTP,omitempty"`
+}
+
+// CertificateConfig is a PEM certificate chain and its key.
+type CertificateConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// ACMEConfig obtains certificates from an ACME CA such as Let's Encrypt.
+type ACMEConfig struct {
+	// Hosts are the only names certificates are requested for.
+	Hosts []string `json:"hosts"`
+	Email string   `json:"email,omitempty"`
+	// CacheDir keeps the account key and certificates across restarts;
+	// "acme-cache" if empty.
+	CacheDir string `json:"cacheDir,omitempty"`
+	// DirectoryURL is the CA's directory; Let's Encrypt if empty.
+	DirectoryURL string `json:"directoryURL,omitempty"`
+}
+
+// RateLimitStoreConfig selects the rate limit store.
+type RateLimitStoreConfig struct {
+	// Type is "memory" or "redis".
+	Type string `json:"type"`
+	// Addr, Password and DB locate the Redis server; Password defaults to
+	// REDIS_PASSWORD.
+	Addr     string `json:"addr,omitempty"`
+	Password string `json:"password,omitempty"`
+	DB       int    `json:"db,omitempty"`
+	// Prefix is prepended to the Redis keys; "loadbalancer:ratelimit:" if
+	// empty.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// RouteConfig is one route. A request is served by the route with the
+// longest prefix that matches its path at a segment boundary: /users matches
+// /users and /users/42 but not /usersettings.
+type RouteConfig struct {
+	Prefix string `json:"prefix"`
+	// Rewrite replaces the prefix before the request is forwarded, e.g.
+	// prefix /api/users with rewrite /users. Empty keeps the path as is.
+	Rewrite  string `json:"rewrite,omitempty"`
+	Strategy string `json:"strategy,omitempty"`
+	// HashOn is the key for the consistent-hash strategy.
+	HashOn  string `json:"hashOn,omitempty"`
+	Retries *int   `json:"retries,omitempty"`
+	// Protocol is spoken to the backends: auto, http1 or h2c.
+	Protocol string `json:"protocol,omitempty"`
+	// MaxBodyBytes caps request bodies; larger ones get 413. Defaults to
+	// server.maxBodyBytes.
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty"`
+
+	// Backends are static upstreams. Service instead takes the UP instances
+	// of a service from the registry.
+	Backends []BackendConfig `json:"backends,omitempty"`
+	Service  string          `json:"service,omitempty"`
+
+	// Splits send part of the traffic to other backends instead, e.g. a
+	// canary release. A request goes to the first split it matches.
+	Splits []SplitConfig `json:"splits,omitempty"`
+	// SplitOn keeps a client in the same percentage slice: header:NAME,
+	// cookie:NAME or ip. Requests are assigned at random if empty.
+	SplitOn string `json:"splitOn,omitempty"`
+
+	HealthCheck      *HealthCheckConfig      `json:"healthCheck,omitempty"`
+	OutlierDetection *OutlierDetectionConfig `json:"outlierDetection,omitempty"`
+	CircuitBreaker   *CircuitBreakerConfig   `json:"circuitBreaker,omitempty"`
+	// RateLimits all apply, in order.
+	RateLimits []RateLimitConfig `json:"rateLimits,omitempty"`
+	// Cache caches the route's GET responses.
+	Cache *RouteCacheConfig `json:"cache,omitempty"`
+}
+
+// RouteCacheConfig caches the responses of a route as the backends' Cache-
+// Control, Expires, ETag and Last-Modified headers allow. Responses marked
+// no-store or private, or setting cookies, are never cached.
+type RouteCacheConfig struct {
+	// TTL keeps responses fresh for that long instead of what the backends
+	// say.
+	TTL Duration `json:"ttl,omitempty"`
+	// Authorized caches the responses to requests with a bearer token that
+	// verifies with JWT_SECRET, separately for each token subject. Requests
+	// with an Authorization header bypass the cache otherwise.
+	Authorized bool `json:"authorized,omitempty"`
+}
+
+// RateLimitConfig is one token bucket limit; see RateLimit.
+type RateLimitConfig struct {
+	// Key is "route", "ip" or "subject".
+	Key  string   `json:"key"`
+	Rate int      `json:"rate"`
+	Per  Duration `json:"per,omitempty"`
+	// Burst is the bucket size; Rate if unset.
+	Burst int `json:"burst,omitempty"`
+}
+
+// SplitConfig is one alternative group of backends of a route. It takes the
+// requests that meet all of its conditions; the other settings of the route
+// apply to it too.
+type SplitConfig struct {
+	Name string `json:"name"`
+	// Headers and Cookies must have the given values; an empty value only
+	// requires them to be present.
+	Headers map[string]string `json:"headers,omitempty"`
+	Cookies map[string]string `json:"cookies,omitempty"`
+	// Roles match requests with a JWT (signed with JWT_SECRET) whose role
+	// claim is one of them.
+	Roles []string `json:"roles,omitempty"`
+	// Percent limits the split to that share of the route's requests. The
+	// shares of a route's splits do not overlap and add up to at most 100.
+	Percent *int `json:"percent,omitempty"`
+
+	Backends []BackendConfig `json:"backends,omitempty"`
+	Service  string          `json:"service,omitempty"`
+}
+
+// BackendConfig is one static upstream.
+type BackendConfig struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// HealthCheckConfig overrides fields of DefaultHealthCheck.
+type HealthCheckConfig struct {
+	Disabled           bool     `json:"disabled,omitempty"`
+	Path               string   `json:"path,omitempty"`
+	Interval           Duration `json:"interval,omitempty"`
+	Timeout            Duration `json:"timeout,omitempty"`
+	UnhealthyThreshold int      `json:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int      `json:"healthyThreshold,omitempty"`
+}
+
+// OutlierDetectionConfig overrides fields of DefaultOutlierDetection.
+type OutlierDetectionConfig struct {
+	Disabled          bool     `json:"disabled,omitempty"`
+	ConsecutiveErrors int      `json:"consecutiveErrors,omitempty"`
+	ErrorRate         float64  `json:"errorRate,omitempty"`
+	MinRequests       int      `json:"minRequests,omitempty"`
+	Interval          Duration `json:"interval,omitempty"`
+	BaseEjection      Duration `json:"baseEjection,omitempty"`
+	MaxEjection       Duration `json:"maxEjection,omitempty"`
+}
+
+// CircuitBreakerConfig overrides fields of DefaultCircuitBreaker.
+type CircuitBreakerConfig struct {
+	Disabled         bool     `json:"disabled,omitempty"`
+	FailureThreshold int      `json:"failureThreshold,omitempty"`
+	SlowThreshold    Duration `json:"slowThreshold,omitempty"`
+	CoolDown         Duration `json:"coolDown,omitempty"`
+	HalfOpenRequests int      `json:"halfOpenRequests,omitempty"`
+	SuccessThreshold int      `json:"successThreshold,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "10s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig reads and validates the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks everything that can be checked without building the
+// routes.
+func (c *Config) Validate() error {
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("no routes")
+	}
+	seen := map[string]bool{}
+	for i, rc := range c.Routes {
+		if !strings.HasPrefix(rc.Prefix, "/") {
+			return fmt.Errorf("route %d: prefix %q must start with /", i, rc.Prefix)
+		}
+		if seen[rc.Prefix] {
+			return fmt.Errorf("route %d: duplicate prefix %q", i, rc.Prefix)
+		}
+		seen[rc.Prefix] = true
+		if rc.Rewrite != "" && !strings.HasPrefix(rc.Rewrite, "/") {
+			return fmt.Errorf("route %s: rewrite %q must start with /", rc.Prefix, rc.Rewrite)
+		}
+		if err := validateBackends(rc.Backends, rc.Service); err != nil {
+			return fmt.Errorf("route %s: %w", rc.Prefix, err)
+		}
+		if err := rc.validateSplits(); err != nil {
+			return fmt.Errorf("route %s: %w", rc.Prefix, err)
+		}
+		if _, err := NewStrategy(rc.Strategy, rc.HashOn); err != nil {
+			return fmt.Errorf("route %s: %w", rc.Prefix, err)
+		}
+		if !validProtocol(rc.Protocol) {
+			return fmt.Errorf("route %s: unknown protocol %q, want auto, http1 or h2c", rc.Prefix, rc.Protocol)
+		}
+		if rc.Retries != nil && *rc.Retries < 0 {
+			return fmt.Errorf("route %s: retries must not be negative", rc.Prefix)
+		}
+		if rc.MaxBodyBytes < 0 {
+			return fmt.Errorf("route %s: maxBodyBytes must not be negative", rc.Prefix)
+		}
+		for _, rl := range rc.RateLimits {
+			switch rl.Key {
+			case RateLimitRoute, RateLimitIP, RateLimitSubject:
+			default:
+				return fmt.Errorf("route %s: unknown rate limit key %q, want route, ip or subject", rc.Prefix, rl.Key)
+			}
+			if rl.Rate <= 0 || rl.Per < 0 || rl.Burst < 0 {
+				return fmt.Errorf("route %s: rate limit needs a positive rate", rc.Prefix)
+			}
+		}
+		if rc.Cache != nil && rc.Cache.TTL < 0 {
+			return fmt.Errorf("route %s: cache ttl must not be negative", rc.Prefix)
+		}
+	}
+	if c.TLS != nil {
+		if err := c.TLS.validate(); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+	if s := c.RateLimitStore; s != nil {
+		switch {
+		case s.Type == "memory":
+		case s.Type == "redis" && s.Addr != "":
+		case s.Type == "redis":
+			return fmt.Errorf("rateLimitStore: redis needs an addr")
+		default:
+			return fmt.Errorf("rateLimitStore: unknown type %q, want memory or redis", s.Type)
+		}
+	}
+	if c.Cache != nil && (c.Cache.MaxBytes < 0 || c.Cache.MaxEntryBytes < 0) {
+		return fmt.Errorf("cache: sizes must not be negative")
+	}
+	return nil
+}
+
+func validateBackends(backends []BackendConfig, service string) error {
+	if (len(backends) == 0) == (service == "") {
+		return fmt.Errorf("needs either backends or a service")
+	}
+	for _, bc := range backends {
+		if _, err := NewBackend(bc.URL, bc.Weight, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rc RouteConfig) validateSplits() error {
+	if len(rc.Splits) == 0 {
+		return nil
+	}
+	if _, err := parseHashKey(rc.SplitOn); err != nil {
+		return fmt.Errorf("splitOn: %w", err)
+	}
+	seen := map[string]bool{}
+	total := 0
+	for _, s := range rc.Splits {
+		if s.Name == "" || strings.ContainsAny(s.Name, "@/") {
+			return fmt.Errorf("split %q needs a name without @ or /", s.Name)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("duplicate split %q", s.Name)
+		}
+		seen[s.Name] = true
+		if s.Percent == nil && len(s.Headers) == 0 && len(s.Cookies) == 0 && len(s.Roles) == 0 {
+			return fmt.Errorf("split %s: needs a percent, headers, cookies or roles", s.Name)
+		}
+		if s.Percent != nil {
+			if *s.Percent < 0 || *s.Percent > 100 {
+				return fmt.Errorf("split %s: percent must be between 0 and 100", s.Name)
+			}
+			total += *s.Percent
+		}
+		if err := validateBackends(s.Backends, s.Service); err != nil {
+			return fmt.Errorf("split %s: %w", s.Name, err)
+		}
+	}
+	if total > 100 {
+		return fmt.Errorf("split percents add up to %d", total)
+	}
+	return nil
+}
+
+func (c *TLSConfig) validate() error {
+	if len(c.Certificates) == 0 && c.ACME == nil {
+		return fmt.Errorf("needs certificates or acme")
+	}
+	for i, cc := range c.Certificates {
+		if cc.CertFile == "" || cc.KeyFile == "" {
+			return fmt.Errorf("certificate %d needs a certFile and a keyFile", i)
+		}
+	}
+	if c.ACME != nil && len(c.ACME.Hosts) == 0 {
+		return fmt.Errorf("acme needs hosts")
+	}
+	switch c.ClientAuth {
+	case "", "require", "optional":
+	default:
+		return fmt.Errorf("unknown clientAuth %q, want require or optional", c.ClientAuth)
+	}
+	if c.ClientAuth != "" && c.ClientCA == "" {
+		return fmt.Errorf("clientAuth needs a clientCA")
+	}
+	switch c.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		return fmt.Errorf("unknown minVersion %q, want 1.2 or 1.3", c.MinVersion)
+	}
+	return nil
+}
+
+// ServerSettings merges the server section into DefaultServer.
+func (c *Config) ServerSettings() ServerConfig {
+	s := DefaultServer
+	o := c.Server
+	if o == nil {
+		return s
+	}
+	if o.ReadHeaderTimeout > 0 {
+		s.ReadHeaderTimeout = o.ReadHeaderTimeout
+	}
+	if o.ReadTimeout > 0 {
+		s.ReadTimeout = o.ReadTimeout
+	}
+	if o.WriteTimeout > 0 {
+		s.WriteTimeout = o.WriteTimeout
+	}
+	if o.IdleTimeout > 0 {
+		s.IdleTimeout = o.IdleTimeout
+	}
+	if o.MaxHeaderBytes > 0 {
+		s.MaxHeaderBytes = o.MaxHeaderBytes
+	}
+	if o.MaxBodyBytes > 0 {
+		s.MaxBodyBytes = o.MaxBodyBytes
+	}
+	if o.ShutdownTimeout > 0 {
+		s.ShutdownTimeout = o.ShutdownTimeout
+	}
+	return s
+}
+
+// NewServer returns a server for handler on addr with the timeouts and
+// limits of the server section.
+func (c *Config) NewServer(addr string, handler http.Handler) *http.Server {
+	s := c.ServerSettings()
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(s.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(s.ReadTimeout),
+		WriteTimeout:      time.Duration(s.WriteTimeout),
+		IdleTimeout:       time.Duration(s.IdleTimeout),
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+	}
+}
+
+// upstream merges the upstream section into DefaultUpstream.
+func (c *Config) upstream() Upstream {
+	u := DefaultUpstream
+	o := c.Upstream
+	if o == nil {
+		return u
+	}
+	if o.DialTimeout > 0 {
+		u.DialTimeout = time.Duration(o.DialTimeout)
+	}
+	if o.ResponseHeaderTimeout > 0 {
+		u.ResponseHeaderTimeout = time.Duration(o.ResponseHeaderTimeout)
+	}
+	if o.IdleConnTimeout > 0 {
+		u.IdleConnTimeout = time.Duration(o.IdleConnTimeout)
+	}
+	if o.MaxIdleConns > 0 {
+		u.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		u.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.MaxConnsPerHost > 0 {
+		u.MaxConnsPerHost = o.MaxConnsPerHost
+	}
+	return u
+}
+
+// cache merges the cache section into DefaultCache.
+func (c *Config) cache() CacheConfig {
+	cc := DefaultCache
+	o := c.Cache
+	if o == nil {
+		return cc
+	}
+	if o.MaxBytes > 0 {
+		cc.MaxBytes = o.MaxBytes
+	}
+	if o.MaxEntryBytes > 0 {
+		cc.MaxEntryBytes = o.MaxEntryBytes
+	}
+	return cc
+}
+
+// maxBodyBytes is the route's cap, or the server's; 0 is no cap.
+func (c *Config) maxBodyBytes(rc RouteConfig) int64 {
+	if rc.MaxBodyBytes > 0 {
+		return rc.MaxBodyBytes
+	}
+	return c.ServerSettings().MaxBodyBytes
+}
+
+// usesRegistry reports whether any route or split discovers its backends.
+func (c *Config) usesRegistry() bool {
+	for _, rc := range c.Routes {
+		if rc.Service != "" {
+			return true
+		}
+		for _, s := range rc.Splits {
+			if s.Service != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// healthCheck merges the route's settings into DefaultHealthCheck.
+func (rc RouteConfig) healthCheck() *HealthCheck {
+	hc := DefaultHealthCheck
+	c := rc.HealthCheck
+	if c == nil {
+		return &hc
+	}
+	if c.Disabled {
+		return nil
+	}
+	if c.Path != "" {
+		hc.Path = c.Path
+	}
+	if c.Interval > 0 {
+		hc.Interval = time.Duration(c.Interval)
+	}
+	if c.Timeout > 0 {
+		hc.Timeout = time.Duration(c.Timeout)
+	}
+	if c.UnhealthyThreshold > 0 {
+		hc.UnhealthyThreshold = c.UnhealthyThreshold
+	}
+	if c.HealthyThreshold > 0 {
+		hc.HealthyThreshold = c.HealthyThreshold
+	}
+	return &hc
+}
+
+// outlierDetection merges the route's settings into
+// DefaultOutlierDetection.
+func (rc RouteConfig) outlierDetection() *OutlierDetection {
+	od := DefaultOutlierDetection
+	c := rc.OutlierDetection
+	if c == nil {
+		return &od
+	}
+	if c.Disabled {
+		return nil
+	}
+	if c.ConsecutiveErrors > 0 {
+		od.ConsecutiveErrors = c.ConsecutiveErrors
+	}
+	if c.ErrorRate > 0 {
+		od.ErrorRate = c.ErrorRate
+	}
+	if c.MinRequests > 0 {
+		od.MinRequests = c.MinRequests
+	}
+	if c.Interval > 0 {
+		od.Interval = time.Duration(c.Interval)
+	}
+	if c.BaseEjection > 0 {
+		od.BaseEjection = time.Duration(c.BaseEjection)
+	}
+	if c.MaxEjection > 0 {
+		od.MaxEjection = time.Duration(c.MaxEjection)
+	}
+	return &od
+}
+
+// circuitBreaker merges the route's settings into DefaultCircuitBreaker.
+func (rc RouteConfig) circuitBreaker() *CircuitBreaker {
+	cb := DefaultCircuitBreaker
+	c := rc.CircuitBreaker
+	if c == nil {
+		return &cb
+	}
+	if c.Disabled {
+		return nil
+	}
+	if c.FailureThreshold > 0 {
+		cb.FailureThreshold = c.FailureThreshold
+	}
+	if c.SlowThreshold > 0 {
+		cb.SlowThreshold = time.Duration(c.SlowThreshold)
+	}
+	if c.CoolDown > 0 {
+		cb.CoolDown = time.Duration(c.CoolDown)
+	}
+	if c.HalfOpenRequests > 0 {
+		cb.HalfOpenRequests = c.HalfOpenRequests
+	}
+	if c.SuccessThreshold > 0 {
+		cb.SuccessThreshold = c.SuccessThreshold
+	}
+	return &cb
+}
+
+// rateLimits fills in the defaults: one second and a burst of one rate.
+func (rc RouteConfig) rateLimits() []RateLimit {
+	var limits []RateLimit
+	for _, c := range rc.RateLimits {
+		limit := RateLimit{Key: c.Key, Rate: c.Rate, Per: time.Duration(c.Per), Burst: c.Burst}
+		if limit.Per == 0 {
+			limit.Per = time.Second
+		}
+		if limit.Burst == 0 {
+			limit.Burst = limit.Rate
+		}
+		limits = append(limits, limit)
+	}
+	return limits
+}
+
+// retries defaults to 2.
+func (rc RouteConfig) retries() int {
+	if rc.Retries == nil {
+		return 2
+	}
+	return *rc.Retries
+}
+
+// watchDelay lets a burst of file events, such as truncate then write,
+// settle before the file is read.
+const watchDelay = 200 * time.Millisecond
+
+// WatchFile calls changed whenever the content of the file at path changes,
+// until ctx is done. It watches the directory, so that editors replacing the
+// file and Kubernetes updating a mounted ConfigMap are noticed too.
+func WatchFile(ctx context.Context, path string, changed func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return err
+	}
+	// Read before returning, so that changes made after the call count.
+	last, _ := os.ReadFile(path)
+	go func() {
+		defer w.Close()
+		settle := time.NewTimer(0)
+		<-settle.C
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-w.Errors:
+				log.Printf("Watching %s: %v", path, err)
+			case <-w.Events:
+				settle.Reset(watchDelay)
+			case <-settle.C:
+				data, err := os.ReadFile(path)
+				if err != nil || bytes.Equal(data, last) {
+					continue
+				}
+				last = data
+				changed()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,94 @@
+package loadbalancer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(rc *RouteConfig)
+		err    string // "" if valid
+	}{
+		{"valid", func(rc *RouteConfig) {}, ""},
+		{"no retries", func(rc *RouteConfig) { rc.Retries = new(int) }, ""},
+		{"negative retries", func(rc *RouteConfig) { rc.Retries = percent(-1) }, "retries must not be negative"},
+		{"relative prefix", func(rc *RouteConfig) { rc.Prefix = "users" }, "must start with /"},
+		{"relative rewrite", func(rc *RouteConfig) { rc.Rewrite = "users" }, "must start with /"},
+		{"backends and service", func(rc *RouteConfig) { rc.Service = "users" }, "either backends or a service"},
+		{"unknown strategy", func(rc *RouteConfig) { rc.Strategy = "random" }, "random"},
+		{"negative body cap", func(rc *RouteConfig) { rc.MaxBodyBytes = -1 }, "maxBodyBytes"},
+		{"unknown rate limit key", func(rc *RouteConfig) { rc.RateLimits = []RateLimitConfig{{Key: "user", Rate: 1}} }, "rate limit key"},
+		{"split percents over 100", func(rc *RouteConfig) {
+			backends := []BackendConfig{{URL: "http://10.0.0.2:8080"}}
+			rc.Splits = []SplitConfig{{Name: "a", Percent: percent(60), Backends: backends}, {Name: "b", Percent: percent(50), Backends: backends}}
+		}, "add up to 110"},
+	} {
+		rc := static("/users")
+		tt.change(&rc)
+		err := (&Config{Routes: []RouteConfig{rc}}).Validate()
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want one about %q", tt.name, err, tt.err)
+		}
+	}
+
+	if err := (&Config{Routes: []RouteConfig{static("/users"), static("/users")}}).Validate(); err == nil {
+		t.Error("Validate accepted a duplicate prefix")
+	}
+	if err := (&Config{}).Validate(); err == nil {
+		t.Error("Validate accepted a config without routes")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loadbalancer.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("routes: []\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	if err := WatchFile(ctx, path, func() { changed <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	expect := func(what string, want bool) {
+		t.Helper()
+		select {
+		case <-changed:
+			if !want {
+				t.Errorf("%s was reported as a change", what)
+			}
+		case <-time.After(5 * watchDelay):
+			if want {
+				t.Errorf("%s was not reported", what)
+			}
+		}
+	}
+
+	write("routes: [1]\n")
+	expect("a write", true)
+	write("routes: [1]\n")
+	expect("a write of the same content", false)
+
+	// Editors and ConfigMap updates replace the file instead.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("routes: [2]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expect("a replaced file", true)
+}
@@ -0,0 +1,205 @@
+package loadbalancer
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheck configures the active probes of a pool's backends.
+type HealthCheck struct {
+	// Path is requested on every backend; a 2xx answer counts as healthy.
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+	// UnhealthyThreshold failed probes in a row take a backend out of
+	// rotation, HealthyThreshold successful ones bring it back.
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// DefaultHealthCheck probes /health every 10 seconds.
+var DefaultHealthCheck = HealthCheck{
+	Path:               "/health",
+	Interval:           10 * time.Second,
+	Timeout:            2 * time.Second,
+	UnhealthyThreshold: 3,
+	HealthyThreshold:   2,
+}
+
+// OutlierDetection configures passive health checking: backends whose
+// proxied requests fail are ejected from rotation for a while. A request
+// fails when the backend cannot be reached or answers with a 5xx.
+type OutlierDetection struct {
+	// ConsecutiveErrors failures in a row eject a backend.
+	ConsecutiveErrors int
+	// ErrorRate ejects a backend whose share of failures within one Interval
+	// reaches it, once the backend has served at least MinRequests.
+	ErrorRate   float64
+	MinRequests int
+	Interval    time.Duration
+	// The n-th ejection in a row lasts BaseEjection * 2^(n-1), up to
+	// MaxEjection. Every Interval without an ejection forgets one.
+	BaseEjection time.Duration
+	MaxEjection  time.Duration
+}
+
+// DefaultOutlierDetection ejects after 5 errors in a row or a 50% error
+// rate, for 30 seconds doubling up to 5 minutes.
+var DefaultOutlierDetection = OutlierDetection{
+	ConsecutiveErrors: 5,
+	ErrorRate:         0.5,
+	MinRequests:       20,
+	Interval:          10 * time.Second,
+	BaseEjection:      30 * time.Second,
+	MaxEjection:       5 * time.Minute,
+}
+
+// health is the state of one backend as seen by the checks.
+type health struct {
+	mu             sync.Mutex
+	unhealthy      bool // failed active probes
+	probeFailures  int
+	probeSuccesses int
+
+	ejectedUntil time.Time
+	ejections    int
+	consecutive  int
+	windowStart  time.Time
+	requests     int
+	failures     int
+}
+
+// Available reports whether the backend currently takes traffic: its active
+// probes pass and it is not ejected.
+func (b *Backend) Available() bool {
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+	return !b.health.unhealthy && !time.Now().Before(b.health.ejectedUntil)
+}
+
+// Healthy reports the result of the active probes.
+func (b *Backend) Healthy() bool {
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+	return !b.health.unhealthy
+}
+
+// EjectedUntil is when the current ejection ends; zero or in the past if the
+// backend is not ejected.
+func (b *Backend) EjectedUntil() time.Time {
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+	return b.health.ejectedUntil
+}
+
+// record feeds the outcome of a proxied request to outlier detection.
+func (b *Backend) record(failed bool) {
+	od := b.outlier.Load()
+	if od == nil {
+		return
+	}
+	h := &b.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.windowStart) >= od.Interval {
+		if h.ejections > 0 && now.Sub(h.ejectedUntil) >= od.Interval {
+			h.ejections--
+		}
+		h.windowStart, h.requests, h.failures = now, 0, 0
+	}
+	h.requests++
+	if !failed {
+		h.consecutive = 0
+		return
+	}
+	h.failures++
+	h.consecutive++
+	if now.Before(h.ejectedUntil) {
+		return
+	}
+	tooMany := od.ConsecutiveErrors > 0 && h.consecutive >= od.ConsecutiveErrors
+	tooOften := od.ErrorRate > 0 && h.requests >= od.MinRequests &&
+		float64(h.failures)/float64(h.requests) >= od.ErrorRate
+	if !tooMany && !tooOften {
+		return
+	}
+	d := od.BaseEjection << min(h.ejections, 16)
+	if od.MaxEjection > 0 && (d > od.MaxEjection || d <= 0) {
+		d = od.MaxEjection
+	}
+	h.ejections++
+	h.ejectedUntil = now.Add(d)
+	h.consecutive, h.requests, h.failures = 0, 0, 0
+	log.Printf("Ejecting backend %s for %s", b.URL, d)
+}
+
+// probe runs one active health check against b.
+func (b *Backend) probe(ctx context.Context, client *http.Client, hc HealthCheck) {
+	probeCtx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+	ok := false
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, b.URL.JoinPath(hc.Path).String(), nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = client.Do(req); err == nil {
+			resp.Body.Close()
+			ok = resp.StatusCode >= 200 && resp.StatusCode < 300
+		}
+	}
+	if ctx.Err() != nil {
+		// Shutting down; not the backend's fault.
+		return
+	}
+
+	h := &b.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ok {
+		h.probeFailures = 0
+		h.probeSuccesses++
+		if h.unhealthy && h.probeSuccesses >= hc.HealthyThreshold {
+			h.unhealthy = false
+			log.Printf("Backend %s is healthy again", b.URL)
+		}
+		return
+	}
+	h.probeSuccesses = 0
+	h.probeFailures++
+	if !h.unhealthy && h.probeFailures >= hc.UnhealthyThreshold {
+		h.unhealthy = true
+		log.Printf("Backend %s failed %d health checks: taking it out of rotation", b.URL, h.probeFailures)
+	}
+}
+
+// Run probes every backend each health check interval until ctx is done. It
+// returns at once if the pool has no active health check.
+func (p *Pool) Run(ctx context.Context) {
+	if p.healthCheck == nil || p.healthCheck.Interval <= 0 {
+		return
+	}
+	client := &http.Client{Transport: p.transport}
+	ticker := time.NewTicker(p.healthCheck.Interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, b := range p.Backends() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.probe(ctx, client, *p.healthCheck)
+			}()
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package loadbalancer
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures a Pool.
+type Option func(*Pool)
+
+// WithHealthCheck probes the backends actively while Run is running.
+func WithHealthCheck(hc HealthCheck) Option {
+	return func(p *Pool) { p.healthCheck = &hc }
+}
+
+// WithOutlierDetection ejects backends whose requests fail.
+func WithOutlierDetection(od OutlierDetection) Option {
+	return func(p *Pool) { p.outlier = &od }
+}
+
+// WithCircuitBreaker puts a circuit breaker in front of every backend.
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(p *Pool) { p.breaker = &cb }
+}
+
+// WithName names the pool, usually after its route, in logs and metrics.
+func WithName(name string) Option {
+	return func(p *Pool) { p.name = name }
+}
+
+// WithTransport sets the transport of backends the pool creates itself,
+// i.e. those discovered from the registry, and of its health checks.
+func WithTransport(t http.RoundTripper) Option {
+	return func(p *Pool) { p.transport = t }
+}
+
+// WithRetries resends an idempotent request without a body to up to n other
+// backends when its backend cannot be reached.
+func WithRetries(n int) Option {
+	return func(p *Pool) { p.retries = n }
+}
+
+// Pool balances the requests of one route over its backends.
+type Pool struct {
+	name        string
+	mu          sync.RWMutex
+	backends    []*Backend
+	strategy    Strategy
+	healthCheck *HealthCheck
+	outlier     *OutlierDetection
+	breaker     *CircuitBreaker
+	retries     int
+	transport   http.RoundTripper
+}
+
+// NewPool returns a pool that spreads requests over backends with strategy.
+// Only backends that pass their health checks get traffic; a pool without
+// any answers 503.
+func NewPool(strategy Strategy, backends []*Backend, opts ...Option) *Pool {
+	p := &Pool{strategy: strategy, transport: http.DefaultTransport}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.SetBackends(backends)
+	return p
+}
+
+// Backends returns the backends of the pool.
+func (p *Pool) Backends() []*Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.backends
+}
+
+// SetBackends replaces the backends of the pool. Requests in flight finish
+// on the backend they were sent to.
+func (p *Pool) SetBackends(backends []*Backend) {
+	for _, b := range backends {
+		b.outlier.Store(p.outlier)
+		b.configure(p.breaker, p.name)
+	}
+	p.mu.Lock()
+	old := p.backends
+	p.backends = slices.Clone(backends)
+	p.mu.Unlock()
+	for _, b := range old {
+		if !slices.Contains(backends, b) {
+			p.forget(b)
+		}
+	}
+}
+
+// forget drops the metrics of a backend that left the pool.
+func (p *Pool) forget(b *Backend) {
+	labels := prometheus.Labels{"route": p.name, "backend": b.URL.String()}
+	telemetry.LoadBalancerBreakerState.Delete(labels)
+	telemetry.LoadBalancerBreakerTransitions.DeletePartialMatch(labels)
+	telemetry.LoadBalancerUpstreamResponses.DeletePartialMatch(labels)
+	telemetry.LoadBalancerUpstreamDuration.Delete(labels)
+	telemetry.LoadBalancerUpstreamErrors.Delete(labels)
+}
+
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, gen := p.pick(r, nil)
+	if b == nil {
+		if retry, ok := p.retryAfter(); ok {
+			// Every usable backend has an open breaker: fail fast.
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retry.Seconds())))))
+			http.Error(w, "Circuit open", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "No healthy backend", http.StatusServiceUnavailable)
+		return
+	}
+	if p.retries > 0 && retryable(r) {
+		a := &attempt{pool: p, tried: []*Backend{b}}
+		a.req = r.WithContext(context.WithValue(r.Context(), attemptKey{}, a))
+		r = a.req
+	}
+	b.serve(w, r, p.name, gen)
+}
+
+// pick chooses among the available backends that are not in exclude and
+// whose breaker lets the request through. gen is the breaker's trial slot,
+// for Backend.serve.
+func (p *Pool) pick(r *http.Request, exclude []*Backend) (b *Backend, gen uint64) {
+	backends := p.Backends()
+	candidates := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		if b.Available() && !b.Draining() && b.ready() && !slices.Contains(exclude, b) {
+			candidates = append(candidates, b)
+		}
+	}
+	for len(candidates) > 0 {
+		b := p.strategy.Pick(r, candidates)
+		if gen, ok := b.acquire(); ok {
+			return b, gen
+		}
+		// Another request took the last trial slot meanwhile.
+		candidates = slices.DeleteFunc(candidates, func(c *Backend) bool { return c == b })
+	}
+	return nil, 0
+}
+
+// retryAfter is how long until the first open breaker of a backend that is
+// otherwise available half-opens; ok is false if there is none.
+func (p *Pool) retryAfter() (d time.Duration, ok bool) {
+	for _, b := range p.Backends() {
+		if !b.Available() {
+			continue
+		}
+		if state, until := b.BreakerState(); state == BreakerOpen {
+			if wait := time.Until(until); !ok || wait < d {
+				d, ok = max(wait, 0), true
+			}
+		}
+	}
+	return d, ok
+}
+
+// retryable reports whether r may be sent again: it is idempotent and has no
+// body that the first attempt could have consumed.
+func retryable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return r.ContentLength == 0 && (r.Body == nil || r.Body == http.NoBody)
+	}
+	return false
+}
+
+type attemptKey struct{}
+
+// attempt tracks the backends a retryable request has been sent to.
+type attempt struct {
+	pool  *Pool
+	req   *http.Request
+	tried []*Backend
+}
+
+// next returns the backend for another try, or nil when the retries are used
+// up or no untried backend is available.
+func (a *attempt) next() (*Backend, uint64) {
+	if len(a.tried) > a.pool.retries {
+		return nil, 0
+	}
+	b, gen := a.pool.pick(a.req, a.tried)
+	if b != nil {
+		a.tried = append(a.tried, b)
+	}
+	return b, gen
+}
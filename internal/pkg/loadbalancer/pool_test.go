@@ -0,0 +1,149 @@
+package loadbalancer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newServerBackend serves h behind a backend of weight 1 until the end of
+// the test.
+func newServerBackend(t *testing.T, h http.Handler) *Backend {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	b, err := NewBackend(srv.URL, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newDeadBackend returns a backend nothing listens on.
+func newDeadBackend(t *testing.T) *Backend {
+	t.Helper()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	b, err := NewBackend(srv.URL, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// counting answers 200 and counts the requests it gets.
+func counting(n *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { n.Add(1) })
+}
+
+func send(p http.Handler, method, body string) int {
+	w := httptest.NewRecorder()
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, "/", nil)
+	} else {
+		r = httptest.NewRequest(method, "/", strings.NewReader(body))
+	}
+	p.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRetriesUnreachableBackend(t *testing.T) {
+	var served atomic.Int32
+	p := NewPool(&RoundRobin{}, []*Backend{newDeadBackend(t), newServerBackend(t, counting(&served))}, WithRetries(1))
+	for i := 0; i < 10; i++ {
+		if code := send(p, http.MethodGet, ""); code != http.StatusOK {
+			t.Fatalf("GET %d answered %d, want 200 from the live backend", i, code)
+		}
+	}
+	if served.Load() != 10 {
+		t.Errorf("the live backend served %d of 10 requests", served.Load())
+	}
+}
+
+func TestDoesNotRetryRequestsWithBodies(t *testing.T) {
+	var served atomic.Int32
+	p := NewPool(&RoundRobin{}, []*Backend{newDeadBackend(t), newServerBackend(t, counting(&served))}, WithRetries(1))
+	if code := send(p, http.MethodPost, `{"item": 1}`); code != http.StatusBadGateway {
+		t.Errorf("POST to the dead backend answered %d, want 502", code)
+	}
+	if served.Load() != 0 {
+		t.Error("the POST was sent again")
+	}
+
+	// Without retries, the dead backend's share of GETs fails too.
+	p = NewPool(&RoundRobin{}, []*Backend{newDeadBackend(t), newServerBackend(t, counting(&served))})
+	if code := send(p, http.MethodGet, ""); code != http.StatusBadGateway {
+		t.Errorf("GET to the dead backend without retries answered %d, want 502", code)
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	var failing, served atomic.Int32
+	bad := newServerBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	good := newServerBackend(t, counting(&served))
+	p := NewPool(&RoundRobin{}, []*Backend{bad, good}, WithOutlierDetection(OutlierDetection{
+		ConsecutiveErrors: 3,
+		Interval:          time.Minute,
+		BaseEjection:      time.Minute,
+	}))
+
+	for i := 0; i < 20; i++ {
+		send(p, http.MethodGet, "")
+	}
+	if failing.Load() != 3 || served.Load() != 17 {
+		t.Errorf("the failing backend got %d requests and the good one %d, want 3 and 17", failing.Load(), served.Load())
+	}
+	if bad.Available() || time.Until(bad.EjectedUntil()) < 50*time.Second {
+		t.Errorf("the failing backend is not ejected for a minute: until %v", bad.EjectedUntil())
+	}
+	if !good.Available() {
+		t.Error("the good backend was ejected")
+	}
+}
+
+func TestActiveHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	b := newServerBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && !healthy.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	p := NewPool(&RoundRobin{}, []*Backend{b}, WithHealthCheck(HealthCheck{
+		Path:               "/health",
+		Interval:           10 * time.Millisecond,
+		Timeout:            time.Second,
+		UnhealthyThreshold: 2,
+		HealthyThreshold:   2,
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	waitUntil := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting until %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitUntil("the backend is out of rotation", func() bool { return !b.Healthy() })
+	if code := send(p, http.MethodGet, ""); code != http.StatusServiceUnavailable {
+		t.Errorf("pool without a healthy backend answered %d, want 503", code)
+	}
+	healthy.Store(true)
+	waitUntil("the backend is back", b.Healthy)
+	if code := send(p, http.MethodGet, ""); code != http.StatusOK {
+		t.Errorf("pool with a healthy backend answered %d, want 200", code)
+	}
+}
@@ -0,0 +1,226 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Rate limit keys: what a limit counts requests by.
+const (
+	// RateLimitRoute shares one bucket among all clients of the route.
+	RateLimitRoute = "route"
+	// RateLimitIP gives every client IP its own bucket.
+	RateLimitIP = "ip"
+	// RateLimitSubject gives every user its own bucket, keyed by the sub or
+	// id claim of their JWT (signed with JWT_SECRET). Requests without a
+	// valid token are counted by IP.
+	RateLimitSubject = "subject"
+)
+
+// RateLimit is a token bucket: it holds up to Burst requests and refills
+// by Rate requests every Per.
+type RateLimit struct {
+	Key   string
+	Rate  int
+	Per   time.Duration
+	Burst int
+}
+
+// RateLimitStore keeps token buckets. Take refills the bucket at key, which
+// holds up to capacity tokens and gains rate tokens per second, takes one
+// token if there is one, and returns the tokens left.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, capacity, rate float64) (tokens float64, allowed bool, err error)
+}
+
+// limiter applies the rate limits of one route.
+type limiter struct {
+	route  string
+	limits []RateLimit
+	store  RateLimitStore
+	secret []byte
+}
+
+// allow takes a token from every limit in order and answers 429 when one is
+// exhausted; later limits are not charged then. It sets the RateLimit-*
+// headers of the most constrained limit. Requests are let through when the
+// store fails.
+func (l *limiter) allow(w http.ResponseWriter, r *http.Request) bool {
+	type outcome struct {
+		limit  RateLimit
+		tokens float64
+	}
+	var tightest *outcome
+	for _, limit := range l.limits {
+		capacity := float64(limit.Burst)
+		rate := float64(limit.Rate) / limit.Per.Seconds()
+		key := fmt.Sprintf("%s|%s|%d/%s/%d|%s", l.route, limit.Key, limit.Rate, limit.Per, limit.Burst, l.client(r, limit.Key))
+		tokens, allowed, err := l.store.Take(r.Context(), key, capacity, rate)
+		if err != nil {
+			log.Printf("Rate limiting %s: %v", l.route, err)
+			continue
+		}
+		o := &outcome{limit, tokens}
+		if tightest == nil || tokens/capacity < tightest.tokens/float64(tightest.limit.Burst) {
+			tightest = o
+		}
+		if !allowed {
+			setRateLimitHeaders(w.Header(), limit, tokens)
+			wait := (1 - tokens) / rate
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait)))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return false
+		}
+	}
+	if tightest != nil {
+		setRateLimitHeaders(w.Header(), tightest.limit, tightest.tokens)
+	}
+	return true
+}
+
+// setRateLimitHeaders writes the RateLimit header fields of the IETF
+// httpapi draft: the bucket size, the requests left and the seconds until
+// the bucket is full again.
+func setRateLimitHeaders(h http.Header, limit RateLimit, tokens float64) {
+	rate := float64(limit.Rate) / limit.Per.Seconds()
+	reset := (float64(limit.Burst) - tokens) / rate
+	h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(tokens))))
+	h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset))))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", limit.Rate, int(math.Ceil(limit.Per.Seconds())), limit.Burst))
+}
+
+// client returns the bucket key of the request's client for a limit key.
+func (l *limiter) client(r *http.Request, key string) string {
+	switch key {
+	case RateLimitRoute:
+		return ""
+	case RateLimitSubject:
+		if id := subject(bearerClaims(r, l.secret)); id != "" {
+			return "id:" + id
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func newLimiter(route string, limits []RateLimit, store RateLimitStore) *limiter {
+	return &limiter{route: route, limits: limits, store: store, secret: []byte(os.Getenv("JWT_SECRET"))}
+}
+
+// MemoryRateLimitStore keeps buckets in this process, so every load
+// balancer replica limits on its own.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will be full and can be forgotten
+}
+
+// NewMemoryRateLimitStore returns an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, capacity, rate float64) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((capacity - b.tokens) / rate * float64(time.Second)))
+	return b.tokens, allowed, nil
+}
+
+// takeScript is the token bucket of RedisRateLimitStore. It runs atomically
+// on the server and uses the server's clock, so that replicas share buckets
+// regardless of their own clocks.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimitStore keeps buckets in Redis, or anything speaking its
+// protocol with Lua scripting, so that all replicas share them.
+type RedisRateLimitStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisRateLimitStore stores buckets under prefix in the Redis server
+// described by opts.
+func NewRedisRateLimitStore(opts *redis.Options, prefix string) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: redis.NewClient(opts), prefix: prefix}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, capacity, rate float64) (float64, bool, error) {
+	res, err := takeScript.Run(ctx, s.client, []string{s.prefix + key}, capacity, rate).Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(res) != 2 {
+		return 0, false, fmt.Errorf("unexpected reply %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	str, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("unexpected reply %v", res)
+	}
+	return tokens, allowed == 1, nil
+}
+
+// Close closes the connections to Redis.
+func (s *RedisRateLimitStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,161 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLimiter(store RateLimitStore, limits ...RateLimit) *limiter {
+	return &limiter{route: "/orders", limits: limits, store: store, secret: []byte(testSecret)}
+}
+
+// take sends a request from ip with the given Authorization header through l.
+func take(l *limiter, ip, auth string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.RemoteAddr = ip + ":40000"
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	if l.allow(w, r) {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	l := newTestLimiter(NewMemoryRateLimitStore(), RateLimit{Key: RateLimitRoute, Rate: 1, Per: time.Minute, Burst: 3})
+	for i, remaining := range []string{"2", "1", "0"} {
+		w := take(l, "192.0.2.1", "")
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("request %d: %d with RateLimit-Remaining %q, want 200 with %s", i, w.Code, w.Header().Get("RateLimit-Remaining"), remaining)
+		}
+	}
+	w := take(l, "192.0.2.2", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past the burst answered %d, want 429", w.Code)
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry < 59 || retry > 60 {
+		t.Errorf("Retry-After %q, want the 60s until the next token", w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("RateLimit-Policy") != "1;w=60;burst=3" {
+		t.Errorf("RateLimit-Policy %q", w.Header().Get("RateLimit-Policy"))
+	}
+}
+
+func TestRateLimitRefills(t *testing.T) {
+	l := newTestLimiter(NewMemoryRateLimitStore(), RateLimit{Key: RateLimitRoute, Rate: 1, Per: 50 * time.Millisecond, Burst: 1})
+	if w := take(l, "192.0.2.1", ""); w.Code != http.StatusOK {
+		t.Fatalf("first request answered %d", w.Code)
+	}
+	if w := take(l, "192.0.2.1", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request answered %d, want 429", w.Code)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if w := take(l, "192.0.2.1", ""); w.Code != http.StatusOK {
+		t.Errorf("request after the refill answered %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	alice := bearer(t, jwt.MapClaims{"id": 1})
+	bob := bearer(t, jwt.MapClaims{"sub": "bob"})
+
+	l := newTestLimiter(NewMemoryRateLimitStore(), RateLimit{Key: RateLimitIP, Rate: 1, Per: time.Minute, Burst: 1})
+	for i, tt := range []struct {
+		ip, auth string
+		want     int
+	}{
+		{"192.0.2.1", alice, http.StatusOK},
+		{"192.0.2.1", bob, http.StatusTooManyRequests},
+		{"192.0.2.2", alice, http.StatusOK},
+	} {
+		if w := take(l, tt.ip, tt.auth); w.Code != tt.want {
+			t.Errorf("by IP, request %d: got %d, want %d", i, w.Code, tt.want)
+		}
+	}
+
+	l = newTestLimiter(NewMemoryRateLimitStore(), RateLimit{Key: RateLimitSubject, Rate: 1, Per: time.Minute, Burst: 1})
+	for i, tt := range []struct {
+		ip, auth string
+		want     int
+	}{
+		{"192.0.2.1", alice, http.StatusOK},
+		{"192.0.2.2", alice, http.StatusTooManyRequests},
+		{"192.0.2.1", bob, http.StatusOK},
+		// Without a valid token, requests are counted by IP.
+		{"192.0.2.1", "", http.StatusOK},
+		{"192.0.2.1", "Bearer forged", http.StatusTooManyRequests},
+		{"192.0.2.2", "Bearer forged", http.StatusOK},
+	} {
+		if w := take(l, tt.ip, tt.auth); w.Code != tt.want {
+			t.Errorf("by subject, request %d: got %d, want %d", i, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRateLimitHeadersOfTightestLimit(t *testing.T) {
+	l := newTestLimiter(NewMemoryRateLimitStore(),
+		RateLimit{Key: RateLimitRoute, Rate: 100, Per: time.Minute, Burst: 10},
+		RateLimit{Key: RateLimitIP, Rate: 2, Per: time.Minute, Burst: 2},
+	)
+	// 9 of 10 tokens left on the route against 1 of 2 for the IP.
+	w := take(l, "192.0.2.1", "")
+	if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("headers of limit %s with %s left, want the IP limit of 2 with 1 left",
+			w.Header().Get("RateLimit-Limit"), w.Header().Get("RateLimit-Remaining"))
+	}
+	take(l, "192.0.2.1", "")
+	w = take(l, "192.0.2.1", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("exhausted IP limit: %d with RateLimit-Limit %s", w.Code, w.Header().Get("RateLimit-Limit"))
+	}
+
+	// Another IP still has its own tokens.
+	w = take(l, "192.0.2.2", "")
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("second IP: %d with RateLimit-Limit %s", w.Code, w.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	limit := RateLimit{Key: RateLimitRoute, Rate: 1, Per: time.Minute, Burst: 2}
+	store := NewRedisRateLimitStore(&redis.Options{Addr: mr.Addr()}, "ratelimit:")
+	defer store.Close()
+	replica := NewRedisRateLimitStore(&redis.Options{Addr: mr.Addr()}, "ratelimit:")
+	defer replica.Close()
+
+	// Two load balancer replicas share the bucket.
+	a, b := newTestLimiter(store, limit), newTestLimiter(replica, limit)
+	for i, tt := range []struct {
+		l    *limiter
+		want int
+	}{
+		{a, http.StatusOK},
+		{b, http.StatusOK},
+		{a, http.StatusTooManyRequests},
+		{b, http.StatusTooManyRequests},
+	} {
+		if w := take(tt.l, "192.0.2.1", ""); w.Code != tt.want {
+			t.Errorf("request %d: got %d, want %d", i, w.Code, tt.want)
+		}
+	}
+	keys := mr.Keys()
+	if len(keys) != 1 || mr.TTL(keys[0]) <= 0 {
+		t.Errorf("Redis keys %v, want one bucket that expires", keys)
+	}
+
+	// Requests are let through while Redis is down.
+	mr.Close()
+	if w := take(a, "192.0.2.1", ""); w.Code != http.StatusOK {
+		t.Errorf("request without Redis answered %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,487 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	regclient "github.com/moodykhalif23/scalebit/internal/pkg/registry/client"
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// discoveryInterval is how often routes with a service copy the registry
+// client's cached instances into their pool.
+const discoveryInterval = time.Second
+
+// Router sends each request to the pool of the route with the longest
+// matching prefix. Load swaps in a new set of routes atomically, so a
+// reload never drops requests or connections.
+type Router struct {
+	mu    sync.Mutex // serialises Load and Close
+	table atomic.Pointer[table]
+
+	registry     *regclient.Client
+	registryURLs []string
+
+	rateLimitStore       RateLimitStore
+	rateLimitStoreConfig RateLimitStoreConfig
+
+	cache       *Cache
+	cacheConfig CacheConfig
+
+	transports map[string]*transport // by protocol
+	upstream   Upstream
+}
+
+type table struct {
+	routes []*route // longest prefix first
+	cancel context.CancelFunc
+}
+
+type route struct {
+	prefix   string
+	rewrite  string
+	strategy string
+	service  string
+	pool     *Pool
+	maxBody  int64    // 0 is no cap
+	limiter  *limiter // nil without rate limits
+	splits   []*split
+	splitOn  *hashKey    // nil assigns percentage slices at random
+	secret   []byte      // verifies the JWTs of role splits
+	cache    *routeCache // nil without caching
+}
+
+// NewRouter returns a router without routes; every request gets a 404
+// until Load is called.
+func NewRouter() *Router {
+	rt := &Router{transports: map[string]*transport{}, upstream: DefaultUpstream}
+	for _, protocol := range protocols {
+		t := &transport{protocol: protocol}
+		t.configure(DefaultUpstream)
+		rt.transports[protocol] = t
+	}
+	rt.table.Store(&table{cancel: func() {}})
+	return rt
+}
+
+// Load replaces the routes with those of cfg. Backends whose route, URL and
+// weight are unchanged keep their health state. On error the current routes
+// stay in place.
+func (rt *Router) Load(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	old := rt.table.Load()
+	previous := map[string][]*Backend{}
+	for _, r := range old.routes {
+		for _, p := range r.pools() {
+			previous[p.name] = p.Backends()
+		}
+	}
+
+	var client *regclient.Client
+	if cfg.usesRegistry() {
+		var err error
+		if client, err = rt.registryClient(cfg.Registry); err != nil {
+			return err
+		}
+	}
+
+	store := rt.rateLimitStoreFor(cfg.RateLimitStore)
+	if cc := cfg.cache(); rt.cache == nil || cc != rt.cacheConfig {
+		rt.cache, rt.cacheConfig = NewCache(cc.MaxBytes, cc.MaxEntryBytes), cc
+		telemetry.LoadBalancerCacheBytes.Set(0)
+	}
+	if up := cfg.upstream(); up != rt.upstream {
+		for _, t := range rt.transports {
+			t.configure(up)
+		}
+		rt.upstream = up
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	next := &table{cancel: cancel}
+	for _, rc := range cfg.Routes {
+		transport := rt.transportFor(rc.Protocol)
+		pool, err := startPool(ctx, rc, rc.Prefix, rc.Backends, rc.Service, transport, previous[rc.Prefix], client)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("route %s: %w", rc.Prefix, err)
+		}
+		r := &route{prefix: rc.Prefix, rewrite: rc.Rewrite, strategy: rc.Strategy, service: rc.Service, pool: pool, maxBody: cfg.maxBodyBytes(rc)}
+		if r.strategy == "" {
+			r.strategy = StrategyRoundRobin
+		}
+		if limits := rc.rateLimits(); len(limits) > 0 {
+			r.limiter = newLimiter(rc.Prefix, limits, store)
+		}
+		if c := rc.Cache; c != nil {
+			r.cache = &routeCache{cache: rt.cache, route: rc.Prefix, ttl: time.Duration(c.TTL), authorized: c.Authorized, secret: []byte(os.Getenv("JWT_SECRET"))}
+		}
+		if len(rc.Splits) > 0 {
+			if rc.SplitOn != "" {
+				on, _ := parseHashKey(rc.SplitOn)
+				r.splitOn = &on
+			}
+			r.secret = []byte(os.Getenv("JWT_SECRET"))
+			lo := 0
+			for _, sc := range rc.Splits {
+				name := rc.Prefix + "@" + sc.Name
+				pool, err := startPool(ctx, rc, name, sc.Backends, sc.Service, transport, previous[name], client)
+				if err != nil {
+					cancel()
+					return fmt.Errorf("route %s: split %s: %w", rc.Prefix, sc.Name, err)
+				}
+				s := &split{name: sc.Name, headers: sc.Headers, cookies: sc.Cookies, roles: sc.Roles, pool: pool}
+				if sc.Percent != nil {
+					s.percent, s.lo, s.hi = true, lo, lo+*sc.Percent
+					lo = s.hi
+				}
+				r.splits = append(r.splits, s)
+			}
+		}
+		next.routes = append(next.routes, r)
+	}
+	sort.SliceStable(next.routes, func(i, j int) bool {
+		return len(next.routes[i].prefix) > len(next.routes[j].prefix)
+	})
+
+	rt.table.Store(next)
+	old.cancel()
+	rt.cache.purge(func(e *cacheEntry) bool {
+		r := next.route(e.route)
+		return r == nil || r.cache == nil
+	})
+	for _, r := range old.routes {
+		if next.route(r.prefix) == nil {
+			labels := prometheus.Labels{"route": r.prefix}
+			telemetry.LoadBalancerRequests.DeletePartialMatch(labels)
+			telemetry.LoadBalancerRequestDuration.DeletePartialMatch(labels)
+			telemetry.LoadBalancerCacheRequests.DeletePartialMatch(labels)
+		}
+		for _, p := range r.pools() {
+			kept := next.pool(p.name)
+			for _, b := range p.Backends() {
+				if kept == nil || !slices.Contains(kept.Backends(), b) {
+					p.forget(b)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// transportFor returns the router's transport for protocol; "" is
+// ProtocolAuto.
+func (rt *Router) transportFor(protocol string) *transport {
+	if protocol == "" {
+		protocol = ProtocolAuto
+	}
+	return rt.transports[protocol]
+}
+
+// startPool builds the pool called name with the settings of route rc and
+// either backends or the instances of service, and starts its health checks
+// and discovery.
+func startPool(ctx context.Context, rc RouteConfig, name string, backends []BackendConfig, service string, transport http.RoundTripper, previous []*Backend, client *regclient.Client) (*Pool, error) {
+	strategy, _ := NewStrategy(rc.Strategy, rc.HashOn)
+	opts := []Option{WithName(name), WithRetries(rc.retries()), WithTransport(transport)}
+	if hc := rc.healthCheck(); hc != nil {
+		opts = append(opts, WithHealthCheck(*hc))
+	}
+	if od := rc.outlierDetection(); od != nil {
+		opts = append(opts, WithOutlierDetection(*od))
+	}
+	if cb := rc.circuitBreaker(); cb != nil {
+		opts = append(opts, WithCircuitBreaker(*cb))
+	}
+
+	var bs []*Backend
+	if service != "" {
+		// Start from the instances known so far; discovery updates them.
+		bs = previous
+	} else {
+		for _, bc := range backends {
+			b, err := reuseBackend(previous, bc.URL, bc.Weight, transport)
+			if err != nil {
+				return nil, err
+			}
+			bs = append(bs, b)
+		}
+	}
+	pool := NewPool(strategy, bs, opts...)
+	go pool.Run(ctx)
+	if service != "" {
+		go pool.discover(ctx, client, service)
+	}
+	return pool, nil
+}
+
+// route returns the route with exactly prefix, or nil.
+func (t *table) route(prefix string) *route {
+	for _, r := range t.routes {
+		if r.prefix == prefix {
+			return r
+		}
+	}
+	return nil
+}
+
+// pool returns the pool called name: a route prefix, or prefix@split for
+// the pool of a split.
+func (t *table) pool(name string) *Pool {
+	for _, r := range t.routes {
+		for _, p := range r.pools() {
+			if p.name == name {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// pools returns the route's own pool followed by those of its splits.
+func (r *route) pools() []*Pool {
+	pools := []*Pool{r.pool}
+	for _, s := range r.splits {
+		pools = append(pools, s.pool)
+	}
+	return pools
+}
+
+// registryClient returns a client for urls, or REGISTRY_URL when urls is
+// empty, creating a new one only when the URLs changed.
+func (rt *Router) registryClient(urls []string) (*regclient.Client, error) {
+	if len(urls) == 0 && os.Getenv("REGISTRY_URL") != "" {
+		urls = strings.Split(os.Getenv("REGISTRY_URL"), ",")
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("routes with a service need registry URLs or REGISTRY_URL")
+	}
+	if rt.registry != nil && slices.Equal(urls, rt.registryURLs) {
+		return rt.registry, nil
+	}
+	opts, err := regclient.OptionsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("registry client: %w", err)
+	}
+	client, err := regclient.New(urls, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if rt.registry != nil {
+		// Routes of the current table still use it until they are replaced.
+		old := rt.registry
+		time.AfterFunc(discoveryInterval, old.Close)
+	}
+	rt.registry, rt.registryURLs = client, urls
+	return client, nil
+}
+
+// rateLimitStoreFor returns the store described by c, keeping the current
+// one, and its buckets, when c did not change.
+func (rt *Router) rateLimitStoreFor(c *RateLimitStoreConfig) RateLimitStore {
+	want := RateLimitStoreConfig{Type: "memory"}
+	if c != nil {
+		want = *c
+	}
+	if want.Type == "redis" {
+		if want.Password == "" {
+			want.Password = os.Getenv("REDIS_PASSWORD")
+		}
+		if want.Prefix == "" {
+			want.Prefix = "loadbalancer:ratelimit:"
+		}
+	}
+	if rt.rateLimitStore != nil && want == rt.rateLimitStoreConfig {
+		return rt.rateLimitStore
+	}
+	if old, ok := rt.rateLimitStore.(*RedisRateLimitStore); ok {
+		// Let requests still holding the old routes finish first.
+		time.AfterFunc(time.Minute, func() { old.Close() })
+	}
+	var store RateLimitStore = NewMemoryRateLimitStore()
+	if want.Type == "redis" {
+		store = NewRedisRateLimitStore(&redis.Options{Addr: want.Addr, Password: want.Password, DB: want.DB}, want.Prefix)
+	}
+	rt.rateLimitStore, rt.rateLimitStoreConfig = store, want
+	return store
+}
+
+// Close stops the health checks and discovery of the current routes.
+func (rt *Router) Close() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.table.Load().cancel()
+	if rt.registry != nil {
+		rt.registry.Close()
+	}
+	if s, ok := rt.rateLimitStore.(*RedisRateLimitStore); ok {
+		s.Close()
+	}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range rt.table.Load().routes {
+		if matchPrefix(r.URL.Path, route.prefix) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			switch {
+			case route.maxBody > 0 && r.ContentLength > route.maxBody:
+				http.Error(sw, "Request body too large", http.StatusRequestEntityTooLarge)
+			case route.limiter == nil || route.limiter.allow(sw, r):
+				if route.maxBody > 0 && r.Body != nil {
+					// Bodies without a length are cut off when they grow too large.
+					r.Body = http.MaxBytesReader(sw, r.Body, route.maxBody)
+				}
+				pool := route.poolFor(r)
+				if route.cache == nil {
+					pool.ServeHTTP(sw, route.rewritten(r))
+					break
+				}
+				route.cache.serve(sw, r, pool.name, func(w http.ResponseWriter, r *http.Request) {
+					pool.ServeHTTP(w, route.rewritten(r))
+				})
+			}
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			telemetry.LoadBalancerRequests.WithLabelValues(route.prefix, strconv.Itoa(sw.status)).Inc()
+			telemetry.LoadBalancerRequestDuration.WithLabelValues(route.prefix).Observe(time.Since(start).Seconds())
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// statusWriter remembers the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap gives http.ResponseController, used by the proxy to flush and to
+// hijack upgraded connections, the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// matchPrefix reports whether path is prefix or lies below it.
+func matchPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// rewritten returns r with the route's prefix replaced by its rewrite, like
+// http.StripPrefix does.
+func (rt *route) rewritten(r *http.Request) *http.Request {
+	if rt.rewrite == "" {
+		return r
+	}
+	path := strings.TrimSuffix(rt.rewrite, "/") + strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(rt.prefix, "/"))
+	if path == "" {
+		path = "/"
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	return r2
+}
+
+// reuseBackend returns the backend in previous with the same URL, weight
+// and transport, or a new one.
+func reuseBackend(previous []*Backend, rawURL string, weight int, transport http.RoundTripper) (*Backend, error) {
+	for _, b := range previous {
+		if b.URL.String() == rawURL && b.configured == max(weight, 1) && b.transport == transport {
+			return b, nil
+		}
+	}
+	return NewBackend(rawURL, weight, transport)
+}
+
+// discover keeps the pool's backends in line with the UP instances of
+// service until ctx is done.
+func (p *Pool) discover(ctx context.Context, client *regclient.Client, service string) {
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	var lastErr string
+	for {
+		instances, err := client.Resolve(ctx, service)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			if err.Error() != lastErr {
+				log.Printf("Discovering %s: %v", service, err)
+				lastErr = err.Error()
+			}
+		default:
+			lastErr = ""
+			p.SetBackends(p.fromInstances(instances))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fromInstances maps the UP instances to backends, keeping the existing
+// backend of an unchanged instance.
+func (p *Pool) fromInstances(instances []registry.Service) []*Backend {
+	current := p.Backends()
+	var backends []*Backend
+	for _, inst := range instances {
+		if inst.Status != registry.StatusUp {
+			continue
+		}
+		address := inst.Address
+		if !strings.Contains(address, "://") {
+			address = "http://" + address
+		}
+		b, err := reuseBackend(current, address, inst.Weight, p.transport)
+		if err != nil {
+			log.Printf("Skipping instance %s: %v", inst.ID, err)
+			continue
+		}
+		backends = append(backends, b)
+	}
+	return backends
+}
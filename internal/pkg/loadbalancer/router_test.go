@@ -0,0 +1,151 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMatchPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		path, prefix string
+		want         bool
+	}{
+		{"/users", "/users", true},
+		{"/users/", "/users", true},
+		{"/users/42", "/users", true},
+		{"/usersettings", "/users", false},
+		{"/user", "/users", false},
+		{"/users/42", "/users/", true},
+		{"/users", "/users/", false},
+		{"/anything", "/", true},
+		{"/api/v1/users", "/api", true},
+		{"/apiv1", "/api", false},
+	} {
+		if got := matchPrefix(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("matchPrefix(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestRewritten(t *testing.T) {
+	for _, tt := range []struct {
+		prefix, rewrite, path, want string
+	}{
+		{"/api/users", "", "/api/users/42", "/api/users/42"},
+		{"/api/users", "/users", "/api/users", "/users"},
+		{"/api/users", "/users", "/api/users/42", "/users/42"},
+		{"/api/users", "/users/", "/api/users/42", "/users/42"},
+		{"/api/users/", "/users", "/api/users/42", "/users/42"},
+		{"/api/users", "/", "/api/users/42", "/42"},
+		{"/api/users", "/", "/api/users", "/"},
+		{"/", "/v2", "/orders", "/v2/orders"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tt.path+"?page=2", nil)
+		got := (&route{prefix: tt.prefix, rewrite: tt.rewrite}).rewritten(r)
+		if got.URL.Path != tt.want || got.URL.RawQuery != "page=2" {
+			t.Errorf("prefix %s, rewrite %q: %s became %s, want %s?page=2", tt.prefix, tt.rewrite, tt.path, got.URL.RequestURI(), tt.want)
+		}
+		if r.URL.Path != tt.path {
+			t.Errorf("prefix %s, rewrite %q changed the original request to %s", tt.prefix, tt.rewrite, r.URL.Path)
+		}
+	}
+}
+
+func TestRouterServesLongestPrefix(t *testing.T) {
+	var paths [2]atomic.Value
+	backend := func(i int) BackendConfig {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { paths[i].Store(r.URL.Path) }))
+		t.Cleanup(srv.Close)
+		return BackendConfig{URL: srv.URL}
+	}
+	users, api := static("/api/users"), static("/api")
+	users.Backends, users.Rewrite = []BackendConfig{backend(0)}, "/users"
+	api.Backends = []BackendConfig{backend(1)}
+	rt := newTestRouter(t, &Config{Routes: []RouteConfig{api, users}})
+
+	for _, tt := range []struct {
+		path    string
+		backend int
+		want    string
+	}{
+		{"/api/users/42", 0, "/users/42"},
+		{"/api/usersettings", 1, "/api/usersettings"},
+		{"/api", 1, "/api"},
+	} {
+		paths[tt.backend].Store("")
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got, _ := paths[tt.backend].Load().(string); w.Code != http.StatusOK || got != tt.want {
+			t.Errorf("%s: %d, backend %d got %q, want %q", tt.path, w.Code, tt.backend, got, tt.want)
+		}
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/apiv2", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/apiv2 answered %d, want 404", w.Code)
+	}
+}
+
+func TestRouterReload(t *testing.T) {
+	var served atomic.Int32
+	srv := httptest.NewServer(counting(&served))
+	defer srv.Close()
+	users := static("/users")
+	users.Backends = []BackendConfig{{URL: srv.URL}, {URL: "http://10.0.0.2:8080", Weight: 2}}
+	rt := newTestRouter(t, &Config{Routes: []RouteConfig{users}})
+
+	before := rt.table.Load().pool("/users").Backends()
+	before[0].SetDraining(true)
+	before[1].SetWeight(5)
+
+	// The backends of an unchanged route are kept, with their state.
+	orders := static("/orders")
+	if err := rt.Load(&Config{Routes: []RouteConfig{users, orders}}); err != nil {
+		t.Fatal(err)
+	}
+	after := rt.table.Load().pool("/users").Backends()
+	if len(after) != 2 || after[0] != before[0] || after[1] != before[1] {
+		t.Fatal("reloading an unchanged route replaced its backends")
+	}
+	if !after[0].Draining() || after[1].Weight() != 5 {
+		t.Errorf("reload lost the backend state: draining %v, weight %d", after[0].Draining(), after[1].Weight())
+	}
+
+	// A backend whose weight changed in the config is a new one.
+	users.Backends[1].Weight = 3
+	if err := rt.Load(&Config{Routes: []RouteConfig{users}}); err != nil {
+		t.Fatal(err)
+	}
+	after = rt.table.Load().pool("/users").Backends()
+	if after[0] != before[0] || after[1] == before[1] || after[1].Weight() != 3 {
+		t.Errorf("reload with a new weight: kept %v, weight %d", after[1] == before[1], after[1].Weight())
+	}
+	if rt.table.Load().route("/orders") != nil {
+		t.Error("the removed route /orders still exists")
+	}
+
+	// Failed reloads leave the routes in place.
+	t.Setenv("REGISTRY_URL", "")
+	invalid := static("/users")
+	invalid.Strategy = "random"
+	discovered := RouteConfig{Prefix: "/payments", Service: "payments"}
+	for _, cfg := range []*Config{
+		{Routes: []RouteConfig{invalid}},
+		{Routes: []RouteConfig{users, discovered}},
+	} {
+		if err := rt.Load(cfg); err == nil {
+			t.Fatalf("Load(%+v) succeeded", cfg.Routes)
+		}
+	}
+	after[0].SetDraining(false)
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Code != http.StatusOK || served.Load() != 1 {
+		t.Errorf("after failed reloads /users answered %d, want 200 from its backend", w.Code)
+	}
+	if got := rt.table.Load().pool("/users").Backends(); len(got) != 2 || got[0] != before[0] {
+		t.Error("a failed reload replaced the backends")
+	}
+}
@@ -0,0 +1,92 @@
+package loadbalancer
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// split sends part of a route's traffic to another group of backends, for
+// canary releases and A/B tests.
+type split struct {
+	name    string
+	headers map[string]string
+	cookies map[string]string
+	roles   []string
+	// percent splits take requests whose bucket is in [lo, hi).
+	percent bool
+	lo, hi  int
+	pool    *Pool
+}
+
+// matches reports whether every condition of the split holds for r. claims
+// parses the bearer token on first use.
+func (s *split) matches(r *http.Request, bucket int, claims func() jwt.MapClaims) bool {
+	if s.percent && (bucket < s.lo || bucket >= s.hi) {
+		return false
+	}
+	for name, want := range s.headers {
+		v, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok || want != "" && !slices.Contains(v, want) {
+			return false
+		}
+	}
+	for name, want := range s.cookies {
+		c, err := r.Cookie(name)
+		if err != nil || want != "" && c.Value != want {
+			return false
+		}
+	}
+	if len(s.roles) > 0 && !slices.ContainsFunc(roles(claims()), func(role string) bool {
+		return slices.Contains(s.roles, role)
+	}) {
+		return false
+	}
+	return true
+}
+
+// roles returns the role claim, a string or a list of them.
+func roles(claims jwt.MapClaims) []string {
+	switch v := claims["role"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// poolFor returns the pool of the first split r matches, or the route's own.
+func (rt *route) poolFor(r *http.Request) *Pool {
+	if len(rt.splits) == 0 {
+		return rt.pool
+	}
+	// The bucket places the client in one of 100 slices of traffic, either
+	// at random or the same slice every time for sticky rollouts.
+	bucket := rand.IntN(100)
+	if rt.splitOn != nil {
+		bucket = int(hash(rt.splitOn.of(r)) % 100)
+	}
+	var claims jwt.MapClaims
+	parsed := false
+	lazyClaims := func() jwt.MapClaims {
+		if !parsed {
+			claims, parsed = bearerClaims(r, rt.secret), true
+		}
+		return claims
+	}
+	for _, s := range rt.splits {
+		if s.matches(r, bucket, lazyClaims) {
+			return s.pool
+		}
+	}
+	return rt.pool
+}
@@ -0,0 +1,132 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestRouter loads cfg into a router that is closed at the end of the
+// test.
+func newTestRouter(t *testing.T, cfg *Config) *Router {
+	t.Helper()
+	t.Setenv("JWT_SECRET", testSecret)
+	rt := NewRouter()
+	t.Cleanup(rt.Close)
+	if err := rt.Load(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+// static is a route config of prefix with one backend nothing is sent to.
+func static(prefix string, splits ...SplitConfig) RouteConfig {
+	return RouteConfig{
+		Prefix:      prefix,
+		Backends:    []BackendConfig{{URL: "http://10.0.0.1:8080"}},
+		HealthCheck: &HealthCheckConfig{Disabled: true},
+		Splits:      splits,
+	}
+}
+
+func percent(n int) *int { return &n }
+
+func TestSplitMatches(t *testing.T) {
+	backends := []BackendConfig{{URL: "http://10.0.0.2:8080"}}
+	rc := static("/products",
+		SplitConfig{Name: "beta", Headers: map[string]string{"X-Beta": "1"}, Backends: backends},
+		SplitConfig{Name: "preview", Headers: map[string]string{"X-Preview": ""}, Backends: backends},
+		SplitConfig{Name: "cookie", Cookies: map[string]string{"canary": "yes"}, Backends: backends},
+		SplitConfig{Name: "any-cookie", Cookies: map[string]string{"tester": ""}, Backends: backends},
+		SplitConfig{Name: "staff", Roles: []string{"admin", "support"}, Backends: backends},
+	)
+	route := newTestRouter(t, &Config{Routes: []RouteConfig{rc}}).table.Load().route("/products")
+
+	for _, tt := range []struct {
+		name   string
+		header []string
+		cookie *http.Cookie
+		want   string
+	}{
+		{"no conditions", nil, nil, "/products"},
+		{"header value", []string{"X-Beta", "1"}, nil, "/products@beta"},
+		{"other header value", []string{"X-Beta", "2"}, nil, "/products"},
+		{"empty header value only needs the header", []string{"X-Preview", "anything"}, nil, "/products@preview"},
+		{"cookie value", nil, &http.Cookie{Name: "canary", Value: "yes"}, "/products@cookie"},
+		{"other cookie value", nil, &http.Cookie{Name: "canary", Value: "no"}, "/products"},
+		{"empty cookie value only needs the cookie", nil, &http.Cookie{Name: "tester", Value: "x"}, "/products@any-cookie"},
+		{"role", []string{"Authorization", bearer(t, jwt.MapClaims{"role": "support"})}, nil, "/products@staff"},
+		{"one of several roles", []string{"Authorization", bearer(t, jwt.MapClaims{"role": []string{"user", "admin"}})}, nil, "/products@staff"},
+		{"other role", []string{"Authorization", bearer(t, jwt.MapClaims{"role": "user"})}, nil, "/products"},
+		{"forged token", []string{"Authorization", "Bearer " + forged(t, jwt.MapClaims{"role": "admin"})}, nil, "/products"},
+		{"first matching split wins", []string{"X-Beta", "1", "X-Preview", ""}, nil, "/products@beta"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/products", nil)
+		for i := 0; i+1 < len(tt.header); i += 2 {
+			r.Header.Set(tt.header[i], tt.header[i+1])
+		}
+		if tt.cookie != nil {
+			r.AddCookie(tt.cookie)
+		}
+		if got := route.poolFor(r).name; got != tt.want {
+			t.Errorf("%s: went to %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// forged signs claims with another secret.
+func forged(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("other-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSplitPercent(t *testing.T) {
+	backends := []BackendConfig{{URL: "http://10.0.0.2:8080"}}
+	rc := static("/products",
+		SplitConfig{Name: "canary", Percent: percent(10), Backends: backends},
+		SplitConfig{Name: "beta", Headers: map[string]string{"X-Beta": ""}, Backends: backends},
+		SplitConfig{Name: "blue", Percent: percent(20), Backends: backends},
+	)
+	rc.SplitOn = "header:X-User"
+	route := newTestRouter(t, &Config{Routes: []RouteConfig{rc}}).table.Load().route("/products")
+
+	// The percentages take consecutive slices of the 100 buckets; the
+	// header split takes none.
+	for i, want := range [][2]int{{0, 10}, {0, 0}, {10, 30}} {
+		if s := route.splits[i]; s.lo != want[0] || s.hi != want[1] {
+			t.Errorf("split %s takes buckets [%d, %d), want [%d, %d)", s.name, s.lo, s.hi, want[0], want[1])
+		}
+	}
+
+	const n = 5000
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		user := func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/products", nil)
+			r.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+			return r
+		}
+		name := route.poolFor(user()).name
+		counts[name]++
+		for j := 0; j < 3; j++ {
+			if again := route.poolFor(user()).name; again != name {
+				t.Fatalf("user-%d moved from %s to %s", i, name, again)
+			}
+		}
+	}
+	for name, want := range map[string]int{"/products@canary": n / 10, "/products@blue": n / 5, "/products": n * 7 / 10} {
+		if got := counts[name]; got < want*3/4 || got > want*5/4 {
+			t.Errorf("%s got %d of %d users, want about %d", name, got, n, want)
+		}
+	}
+	if counts["/products@beta"] != 0 {
+		t.Errorf("the header split got %d users without the header", counts["/products@beta"])
+	}
+}
@@ -0,0 +1,249 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Strategy names accepted by NewStrategy.
+const (
+	StrategyRoundRobin         = "round-robin"
+	StrategyWeightedRoundRobin = "weighted-round-robin"
+	StrategyLeastConnections   = "least-connections"
+	StrategyPowerOfTwo         = "p2c"
+	StrategyConsistentHash     = "consistent-hash"
+)
+
+// Strategy chooses the backend for a request. backends is never empty.
+// Implementations must be safe for concurrent use.
+type Strategy interface {
+	Pick(r *http.Request, backends []*Backend) *Backend
+}
+
+// NewStrategy returns the strategy called name; an empty name is round-robin.
+// hashOn only applies to consistent hashing; see ConsistentHash.
+func NewStrategy(name, hashOn string) (Strategy, error) {
+	switch name {
+	case "", StrategyRoundRobin:
+		return &RoundRobin{}, nil
+	case StrategyWeightedRoundRobin:
+		return &WeightedRoundRobin{}, nil
+	case StrategyLeastConnections:
+		return &LeastConnections{}, nil
+	case StrategyPowerOfTwo:
+		return PowerOfTwo{}, nil
+	case StrategyConsistentHash:
+		return NewConsistentHash(hashOn)
+	}
+	return nil, fmt.Errorf("unknown load balancing strategy %q", name)
+}
+
+// RoundRobin cycles through the backends, ignoring weights.
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func (s *RoundRobin) Pick(_ *http.Request, backends []*Backend) *Backend {
+	return backends[(s.next.Add(1)-1)%uint64(len(backends))]
+}
+
+// WeightedRoundRobin is nginx's smooth weighted round-robin: a backend of
+// weight 3 gets three of every four requests next to one of weight 1, spread
+// out rather than in bursts.
+type WeightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[*Backend]int
+}
+
+func (s *WeightedRoundRobin) Pick(_ *http.Request, backends []*Backend) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil {
+		s.current = make(map[*Backend]int)
+	}
+	var best *Backend
+	total := 0
+	for _, b := range backends {
+		weight := b.Weight()
+		s.current[b] += weight
+		total += weight
+		if best == nil || s.current[b] > s.current[best] {
+			best = b
+		}
+	}
+	s.current[best] -= total
+	if len(s.current) > 2*len(backends) {
+		// Forget backends that left the pool.
+		for b := range s.current {
+			if !slices.Contains(backends, b) {
+				delete(s.current, b)
+			}
+		}
+	}
+	return best
+}
+
+// LeastConnections picks the backend with the fewest requests in flight
+// relative to its weight. Ties rotate so that idle backends share the load.
+type LeastConnections struct {
+	next atomic.Uint64
+}
+
+func (s *LeastConnections) Pick(_ *http.Request, backends []*Backend) *Backend {
+	start := int((s.next.Add(1) - 1) % uint64(len(backends)))
+	best := backends[start]
+	for i := 1; i < len(backends); i++ {
+		b := backends[(start+i)%len(backends)]
+		if b.load() < best.load() {
+			best = b
+		}
+	}
+	return best
+}
+
+// PowerOfTwo samples two backends at random and takes the less loaded one,
+// which comes close to least-connections without scanning every backend.
+type PowerOfTwo struct{}
+
+func (PowerOfTwo) Pick(_ *http.Request, backends []*Backend) *Backend {
+	if len(backends) == 1 {
+		return backends[0]
+	}
+	i := rand.IntN(len(backends))
+	j := rand.IntN(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+	if backends[j].load() < backends[i].load() {
+		return backends[j]
+	}
+	return backends[i]
+}
+
+// replicas is the number of points per unit of weight on the hash ring.
+const replicas = 100
+
+// ConsistentHash sends requests with the same key to the same backend for
+// sticky sessions. When a backend leaves, only its keys move.
+type ConsistentHash struct {
+	on hashKey
+
+	mu      sync.Mutex
+	members []*Backend
+	weights []int
+	ring    []ringPoint
+}
+
+type ringPoint struct {
+	hash    uint64
+	backend *Backend
+}
+
+// NewConsistentHash hashes on "header:NAME" or "cookie:NAME". Requests
+// without that header or cookie, or any request when hashOn is empty or
+// "ip", are hashed on the client IP.
+func NewConsistentHash(hashOn string) (*ConsistentHash, error) {
+	on, err := parseHashKey(hashOn)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsistentHash{on: on}, nil
+}
+
+func (s *ConsistentHash) Pick(r *http.Request, backends []*Backend) *Backend {
+	h := hash(s.on.of(r))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Equal(s.members, backends) || !slices.Equal(s.weights, weights(backends)) {
+		s.build(backends)
+	}
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].backend
+}
+
+// hashKey is what requests are hashed on: a header, a cookie or, without
+// either, the client IP.
+type hashKey struct {
+	header string
+	cookie string
+}
+
+// parseHashKey parses "header:NAME", "cookie:NAME", "ip" or "".
+func parseHashKey(spec string) (hashKey, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+	switch {
+	case spec == "" || spec == "ip":
+		return hashKey{}, nil
+	case kind == "header" && name != "":
+		return hashKey{header: name}, nil
+	case kind == "cookie" && name != "":
+		return hashKey{cookie: name}, nil
+	}
+	return hashKey{}, fmt.Errorf("invalid hash key %q, want header:NAME, cookie:NAME or ip", spec)
+}
+
+// of returns the key of r, falling back to the client IP.
+func (k hashKey) of(r *http.Request) string {
+	if k.header != "" {
+		if v := r.Header.Get(k.header); v != "" {
+			return v
+		}
+	}
+	if k.cookie != "" {
+		if c, err := r.Cookie(k.cookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func (s *ConsistentHash) build(backends []*Backend) {
+	s.members = slices.Clone(backends)
+	s.weights = weights(backends)
+	s.ring = s.ring[:0]
+	for i, b := range backends {
+		for j := 0; j < replicas*s.weights[i]; j++ {
+			s.ring = append(s.ring, ringPoint{hash(b.URL.String() + "#" + strconv.Itoa(j)), b})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+}
+
+func weights(backends []*Backend) []int {
+	w := make([]int, len(backends))
+	for i, b := range backends {
+		w[i] = b.Weight()
+	}
+	return w
+}
+
+// hash is FNV-1a followed by a finaliser, since FNV alone clusters the
+// points of keys that only differ in their last characters.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
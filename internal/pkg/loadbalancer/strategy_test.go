@@ -0,0 +1,199 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestBackends returns one backend per weight; none of them is reached.
+func newTestBackends(t *testing.T, weights ...int) []*Backend {
+	t.Helper()
+	var backends []*Backend
+	for i, w := range weights {
+		b, err := NewBackend(fmt.Sprintf("http://10.0.0.%d:8080", i+1), w, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// distribution picks n times and counts the picks of each backend.
+func distribution(s Strategy, backends []*Backend, n int, req func(i int) *http.Request) map[*Backend]int {
+	counts := make(map[*Backend]int)
+	for i := 0; i < n; i++ {
+		counts[s.Pick(req(i), backends)]++
+	}
+	return counts
+}
+
+func anyRequest(int) *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/", nil)
+}
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range []string{"", StrategyRoundRobin, StrategyWeightedRoundRobin, StrategyLeastConnections, StrategyPowerOfTwo, StrategyConsistentHash} {
+		if _, err := NewStrategy(name, ""); err != nil {
+			t.Errorf("NewStrategy(%q): %v", name, err)
+		}
+	}
+	if _, err := NewStrategy("random", ""); err == nil {
+		t.Error("NewStrategy accepted an unknown strategy")
+	}
+	if _, err := NewStrategy(StrategyConsistentHash, "query:id"); err == nil {
+		t.Error("NewStrategy accepted an invalid hash key")
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	backends := newTestBackends(t, 1, 5, 1)
+	counts := distribution(&RoundRobin{}, backends, 300, anyRequest)
+	for _, b := range backends {
+		if counts[b] != 100 {
+			t.Errorf("%s got %d of 300 picks, want 100 whatever its weight", b.URL, counts[b])
+		}
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	backends := newTestBackends(t, 5, 1, 1)
+	s := &WeightedRoundRobin{}
+	var seq []*Backend
+	for i := 0; i < 700; i++ {
+		seq = append(seq, s.Pick(nil, backends))
+	}
+	counts := make(map[*Backend]int)
+	run, longest := 0, 0
+	for i, b := range seq {
+		counts[b]++
+		if i > 0 && b == seq[i-1] {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+	for i, want := range []int{500, 100, 100} {
+		if counts[backends[i]] != want {
+			t.Errorf("%s got %d of 700 picks, want %d", backends[i].URL, counts[backends[i]], want)
+		}
+	}
+	// Smooth: 5:1:1 cycles a a b a c a a rather than a a a a a b c.
+	if longest > 4 {
+		t.Errorf("the heaviest backend got %d picks in a row, want at most 4", longest)
+	}
+
+	backends[1].SetWeight(5)
+	counts = distribution(s, backends, 1100, anyRequest)
+	if counts[backends[0]] != 500 || counts[backends[1]] != 500 || counts[backends[2]] != 100 {
+		t.Errorf("after a weight change got %d/%d/%d of 1100 picks, want 500/500/100",
+			counts[backends[0]], counts[backends[1]], counts[backends[2]])
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	backends := newTestBackends(t, 1, 1, 2)
+	backends[0].inFlight.Store(1)
+	backends[1].inFlight.Store(4)
+	backends[2].inFlight.Store(3)
+	s := &LeastConnections{}
+	// 3 in flight on weight 2 is less loaded than 4 on weight 1, but not than 1.
+	counts := distribution(s, backends, 30, anyRequest)
+	if counts[backends[0]] != 30 {
+		t.Errorf("picks %v, want all on the least loaded backend", counts)
+	}
+
+	backends[0].inFlight.Store(0)
+	backends[1].inFlight.Store(0)
+	backends[2].inFlight.Store(0)
+	counts = distribution(s, backends, 300, anyRequest)
+	for _, b := range backends {
+		if counts[b] != 100 {
+			t.Errorf("idle %s got %d of 300 picks, want ties to rotate", b.URL, counts[b])
+		}
+	}
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	backends := newTestBackends(t, 1, 1, 1)
+	backends[1].inFlight.Store(10)
+	counts := distribution(PowerOfTwo{}, backends, 3000, anyRequest)
+	// The busiest backend loses every comparison it is drawn into.
+	if counts[backends[1]] != 0 {
+		t.Errorf("the busiest backend got %d picks", counts[backends[1]])
+	}
+	for _, b := range []*Backend{backends[0], backends[2]} {
+		if counts[b] < 1200 {
+			t.Errorf("%s got %d of 3000 picks, want about half", b.URL, counts[b])
+		}
+	}
+	if got := (PowerOfTwo{}).Pick(nil, backends[:1]); got != backends[0] {
+		t.Error("a single backend was not picked")
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	backends := newTestBackends(t, 1, 1, 2)
+	s, err := NewConsistentHash("header:X-User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := func(i int) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+		return r
+	}
+
+	const n = 8000
+	first := make([]*Backend, n)
+	counts := make(map[*Backend]int)
+	for i := range first {
+		first[i] = s.Pick(user(i), backends)
+		counts[first[i]]++
+		if again := s.Pick(user(i), backends); again != first[i] {
+			t.Fatalf("user-%d moved from %s to %s", i, first[i].URL, again.URL)
+		}
+	}
+	// Each unit of weight should get about a quarter of the keys.
+	for i, want := range []int{n / 4, n / 4, n / 2} {
+		if got := counts[backends[i]]; got < want*3/4 || got > want*5/4 {
+			t.Errorf("%s (weight %d) got %d of %d keys, want about %d", backends[i].URL, backends[i].Weight(), got, n, want)
+		}
+	}
+
+	// Only the keys of a backend that leaves move.
+	remaining := []*Backend{backends[0], backends[2]}
+	for i := range first {
+		got := s.Pick(user(i), remaining)
+		if first[i] != backends[1] && got != first[i] {
+			t.Fatalf("user-%d moved from %s to %s when another backend left", i, first[i].URL, got.URL)
+		}
+	}
+}
+
+func TestConsistentHashFallsBackToClientIP(t *testing.T) {
+	backends := newTestBackends(t, 1, 1, 1)
+	s, _ := NewConsistentHash("cookie:session")
+	req := func(ip string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = ip + ":40000"
+		return r
+	}
+	spread := make(map[*Backend]bool)
+	for i := 0; i < 50; i++ {
+		ip := fmt.Sprintf("192.0.2.%d", i)
+		b := s.Pick(req(ip), backends)
+		spread[b] = true
+		other := req(ip)
+		other.RemoteAddr = ip + ":50000"
+		if s.Pick(other, backends) != b {
+			t.Fatalf("%s moved when only its port changed", ip)
+		}
+	}
+	if len(spread) != len(backends) {
+		t.Errorf("50 client IPs went to %d of %d backends", len(spread), len(backends))
+	}
+}
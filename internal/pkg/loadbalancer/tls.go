@@ -0,0 +1,162 @@
+package loadbalancer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS terminates HTTPS: it picks certificates by SNI, from files or ACME,
+// offers HTTP/2 and optionally verifies client certificates.
+type TLS struct {
+	state atomic.Pointer[tlsState]
+	acme  *autocert.Manager // nil without ACME
+}
+
+type tlsState struct {
+	certificates []tls.Certificate
+	config       *tls.Config
+}
+
+// NewTLS loads the certificates of cfg. ACME settings cannot be changed
+// later.
+func NewTLS(cfg *TLSConfig) (*TLS, error) {
+	t := &TLS{}
+	if a := cfg.ACME; a != nil {
+		dir := a.CacheDir
+		if dir == "" {
+			dir = "acme-cache"
+		}
+		t.acme = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(dir),
+			HostPolicy: autocert.HostWhitelist(a.Hosts...),
+			Email:      a.Email,
+		}
+		if a.DirectoryURL != "" {
+			t.acme.Client = &acme.Client{DirectoryURL: a.DirectoryURL}
+		}
+	}
+	if err := t.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload rereads the certificate files and client CA of cfg, e.g. after
+// they were renewed. New connections use them; on error the current ones
+// stay in use.
+func (t *TLS) Reload(cfg *TLSConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	st := &tlsState{}
+	for _, c := range cfg.Certificates {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return fmt.Errorf("certificate %s: %w", c.CertFile, err)
+		}
+		st.certificates = append(st.certificates, cert)
+	}
+
+	conf := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: t.getCertificate,
+	}
+	if cfg.MinVersion == "1.3" {
+		conf.MinVersion = tls.VersionTLS13
+	}
+	if t.acme != nil {
+		conf.NextProtos = append(conf.NextProtos, acme.ALPNProto)
+	}
+	if cfg.ClientCA != "" {
+		pem, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return fmt.Errorf("client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", cfg.ClientCA)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfg.ClientAuth == "optional" {
+			conf.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	st.config = conf
+	t.state.Store(st)
+	return nil
+}
+
+// Config returns the tls.Config for the HTTPS server.
+func (t *TLS) Config() *tls.Config {
+	return &tls.Config{GetConfigForClient: t.configForClient}
+}
+
+func (t *TLS) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	conf := t.state.Load().config
+	if slices.Contains(hello.SupportedProtos, acme.ALPNProto) && conf.ClientAuth != tls.NoClientCert {
+		// The CA validating a TLS-ALPN-01 challenge has no client certificate.
+		conf = conf.Clone()
+		conf.ClientAuth = tls.NoClientCert
+	}
+	return conf, nil
+}
+
+// getCertificate prefers a certificate file covering the server name, then
+// ACME, then the first certificate file.
+func (t *TLS) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if t.acme != nil && slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+		return t.acme.GetCertificate(hello)
+	}
+	certs := t.state.Load().certificates
+	for i := range certs {
+		if hello.ServerName != "" && hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+	if t.acme != nil {
+		cert, err := t.acme.GetCertificate(hello)
+		if err == nil || len(certs) == 0 {
+			return cert, err
+		}
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+	}
+	return &certs[0], nil
+}
+
+// RedirectHandler redirects plain HTTP requests to HTTPS on the port of
+// httpsAddr, e.g. ":443", and answers ACME HTTP-01 challenges.
+func (t *TLS) RedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+	if t.acme != nil {
+		h = t.acme.HTTPHandler(h)
+	}
+	return h
+}
@@ -0,0 +1,96 @@
+package loadbalancer
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Protocols a route speaks to its backends.
+const (
+	// ProtocolAuto uses HTTP/2 with https backends that offer it and
+	// HTTP/1.1 otherwise. It is the default.
+	ProtocolAuto = "auto"
+	// ProtocolHTTP1 always uses HTTP/1.1.
+	ProtocolHTTP1 = "http1"
+	// ProtocolH2C uses HTTP/2 without TLS with http backends, assuming they
+	// support it (prior knowledge), e.g. gRPC servers.
+	ProtocolH2C = "h2c"
+)
+
+var protocols = []string{ProtocolAuto, ProtocolHTTP1, ProtocolH2C}
+
+// Upstream tunes the connections to the backends.
+type Upstream struct {
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout is how long a backend may take to start its
+	// response; it answers 504 then.
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	// MaxConnsPerHost caps the connections to one backend; requests beyond
+	// it wait. No limit if 0.
+	MaxConnsPerHost int
+}
+
+// DefaultUpstream keeps up to 64 idle connections per backend.
+var DefaultUpstream = Upstream{
+	DialTimeout:           5 * time.Second,
+	ResponseHeaderTimeout: 30 * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+	MaxIdleConns:          1024,
+	MaxIdleConnsPerHost:   64,
+}
+
+// transport is shared by all backends speaking the same protocol, so that
+// they share idle connections too. Its settings can be replaced without
+// replacing the backends.
+type transport struct {
+	protocol string
+	current  atomic.Pointer[http.Transport]
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.current.Load().RoundTrip(r)
+}
+
+// configure switches new requests to a transport with the settings of u;
+// the connections of the old one are closed once they are idle.
+func (t *transport) configure(u Upstream) {
+	dialer := &net.Dialer{Timeout: u.DialTimeout, KeepAlive: 30 * time.Second}
+	next := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          u.MaxIdleConns,
+		MaxIdleConnsPerHost:   u.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       u.MaxConnsPerHost,
+		IdleConnTimeout:       u.IdleConnTimeout,
+		ResponseHeaderTimeout: u.ResponseHeaderTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	switch t.protocol {
+	case ProtocolHTTP1:
+		next.Protocols = new(http.Protocols)
+		next.Protocols.SetHTTP1(true)
+	case ProtocolH2C:
+		next.Protocols = new(http.Protocols)
+		next.Protocols.SetHTTP2(true)
+		next.Protocols.SetUnencryptedHTTP2(true)
+	}
+	if old := t.current.Swap(next); old != nil {
+		old.CloseIdleConnections()
+		// Connections busy now become idle later.
+		time.AfterFunc(u.ResponseHeaderTimeout+time.Minute, old.CloseIdleConnections)
+	}
+}
+
+// validProtocol reports whether protocol is one of the Protocol constants
+// or "", which is ProtocolAuto.
+func validProtocol(protocol string) bool {
+	return protocol == "" || slices.Contains(protocols, protocol)
+}
@@ -0,0 +1,292 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Version = "3.0.3"
+
+// BearerAuth is the name of the JWT security scheme in every document.
+const BearerAuth = "bearerAuth"
+
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                 `json:"operationId,omitempty"`
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]SecurityRequirement `json:"security,omitempty"`
+	// Roles lists the JWT "role" values allowed to call the operation. Empty
+	// means any authenticated caller.
+	Roles []string `json:"x-scalebit-roles,omitempty"`
+	// Internal operations are not exposed through the API gateway.
+	Internal bool `json:"x-scalebit-internal,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type SecurityRequirement map[string][]string
+
+// Route describes one handler registered on a service router.
+type Route struct {
+	Method  string
+	Path    string // gorilla/mux template, e.g. "/users/{id:[0-9]+}"
+	Summary string
+	// Request and Response are zero values of the Go types carried in the
+	// JSON bodies; nil means no body.
+	Request  interface{}
+	Response interface{}
+	// Status is the success status code, http.StatusOK if unset.
+	Status int
+	// Public routes are served without a JWT.
+	Public bool
+	// Internal routes are left out of the API gateway config.
+	Internal bool
+	Roles    []string
+}
+
+var muxVar = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// Build assembles the document for a service from its route table. All
+// routes require the bearer JWT unless marked Public.
+func Build(title, version string, routes []Route) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				BearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		Security: []SecurityRequirement{{BearerAuth: {}}},
+	}
+	for _, rt := range routes {
+		path, params := convertPath(rt.Path)
+		op := &Operation{
+			OperationID: operationID(rt.Method, path),
+			Summary:     rt.Summary,
+			Tags:        []string{title},
+			Parameters:  params,
+			Responses:   map[string]*Response{},
+			Roles:       rt.Roles,
+			Internal:    rt.Internal,
+		}
+		if rt.Public {
+			op.Security = &[]SecurityRequirement{}
+		}
+		if rt.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  jsonContent(doc.schemaFor(reflect.TypeOf(rt.Request))),
+			}
+		}
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		resp := &Response{Description: http.StatusText(status)}
+		if rt.Response != nil {
+			resp.Content = jsonContent(doc.schemaFor(reflect.TypeOf(rt.Response)))
+		}
+		op.Responses[strconv.Itoa(status)] = resp
+		if rt.Request != nil || len(params) > 0 {
+			op.Responses["400"] = &Response{Description: http.StatusText(http.StatusBadRequest)}
+		}
+		if !rt.Public {
+			op.Responses["401"] = &Response{Description: http.StatusText(http.StatusUnauthorized)}
+		}
+		if len(params) > 0 {
+			op.Responses["404"] = &Response{Description: http.StatusText(http.StatusNotFound)}
+		}
+		op.Responses["500"] = &Response{Description: http.StatusText(http.StatusInternalServerError)}
+
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+	return doc
+}
+
+// convertPath turns a mux path template into an OpenAPI path and its
+// parameters. Variables constrained to digits become integers.
+func convertPath(muxPath string) (string, []Parameter) {
+	var params []Parameter
+	path := muxVar.ReplaceAllStringFunc(muxPath, func(m string) string {
+		parts := muxVar.FindStringSubmatch(m)
+		schema := &Schema{Type: "string"}
+		if parts[2] == ":[0-9]+" {
+			schema = &Schema{Type: "integer"}
+		}
+		params = append(params, Parameter{Name: parts[1], In: "path", Required: true, Schema: schema})
+		return "{" + parts[1] + "}"
+	})
+	return path, params
+}
+
+// operationID derives a stable id such as "getUsersId" from method and path.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, seg := range strings.Split(path, "/") {
+		seg = strings.Trim(seg, "{}")
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema for t, registering named structs under
+// components/schemas and referring to them by $ref.
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Uint:
+		return &Schema{Type: "integer"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate.
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.schemaFor(f.Type)
+	}
+	return s
+}
+
+// Marshal renders the document as indented JSON with a trailing newline, the
+// form committed under api/openapi.
+func Marshal(doc *Document) ([]byte, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Handler serves the document at /openapi.json.
+func Handler(doc *Document) http.HandlerFunc {
+	data, err := Marshal(doc)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
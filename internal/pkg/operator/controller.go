@@ -29,6 +29,27 @@ var _ reconcile.Reconciler = &MicroserviceReconciler{}
 
 func pointerToInt32(i int32) *int32 { return &i }
 
+// autoscalingBounds returns the HPA min/max replicas and CPU target, falling
+// back to 1/5/50% for anything the spec leaves unset.
+func autoscalingBounds(ms *v1alpha1.Microservice) (int32, int32, int32) {
+	minReplicas, maxReplicas, targetCPU := int32(1), int32(5), int32(50)
+	if as := ms.Spec.Autoscaling; as != nil {
+		if as.MinReplicas > 0 {
+			minReplicas = as.MinReplicas
+		}
+		if as.MaxReplicas > 0 {
+			maxReplicas = as.MaxReplicas
+		}
+		if as.TargetCPUUtilization > 0 {
+			targetCPU = as.TargetCPUUtilization
+		}
+	}
+	if maxReplicas < minReplicas {
+		maxReplicas = minReplicas
+	}
+	return minReplicas, maxReplicas, targetCPU
+}
+
 func (r *MicroserviceReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 	logger := log.FromContext(ctx)
 
@@ -65,9 +86,17 @@ func (r *MicroserviceReconciler) Reconcile(ctx context.Context, req reconcile.Re
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{{
-						Name:  ms.Name,
-						Image: ms.Spec.Image,
-						Ports: []corev1.ContainerPort{{ContainerPort: ms.Spec.Port}},
+						Name:      ms.Name,
+						Image:     ms.Spec.Image,
+						Ports:     []corev1.ContainerPort{{ContainerPort: ms.Spec.Port}},
+						Resources: ms.Spec.Resources,
+						// POD_IP is the address services register with the service registry.
+						Env: []corev1.EnvVar{{
+							Name: "POD_IP",
+							ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"},
+							},
+						}},
 					}},
 				},
 			},
@@ -115,6 +144,7 @@ func (r *MicroserviceReconciler) Reconcile(ctx context.Context, req reconcile.Re
 	}
 
 	// Create or update HorizontalPodAutoscaler
+	minReplicas, maxReplicas, targetCPU := autoscalingBounds(&ms)
 	hpa := &autoscalingv2.HorizontalPodAutoscaler{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      ms.Name + "-hpa",
@@ -126,15 +156,15 @@ func (r *MicroserviceReconciler) Reconcile(ctx context.Context, req reconcile.Re
 				Kind:       "Deployment",
 				Name:       ms.Name,
 			},
-			MinReplicas: pointerToInt32(1),
-			MaxReplicas: 5,
+			MinReplicas: pointerToInt32(minReplicas),
+			MaxReplicas: maxReplicas,
 			Metrics: []autoscalingv2.MetricSpec{{
 				Type: autoscalingv2.ResourceMetricSourceType,
 				Resource: &autoscalingv2.ResourceMetricSource{
 					Name: corev1.ResourceCPU,
 					Target: autoscalingv2.MetricTarget{
 						Type:               autoscalingv2.UtilizationMetricType,
-						AverageUtilization: pointerToInt32(50),
+						AverageUtilization: pointerToInt32(targetCPU),
 					},
 				},
 			}},
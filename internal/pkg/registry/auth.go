@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/moodykhalif23/scalebit/internal/pkg/security"
+)
+
+// Action is what a request wants to do with the registry.
+type Action string
+
+const (
+	// ActionRead lists instances, watches changes and reads cluster status.
+	ActionRead Action = "read"
+	// ActionWrite registers, heartbeats or deregisters instances of one
+	// service.
+	ActionWrite Action = "write"
+)
+
+// Scopes understood by ScopePolicy. They are read from the space-separated
+// "scope" claim of the platform JWT.
+const (
+	ScopeRead  = "registry:read"
+	ScopeAdmin = "registry:admin"
+	// ScopeRegisterPrefix + name allows writing the instances of service
+	// name; ScopeRegisterPrefix + "*" allows every service.
+	ScopeRegisterPrefix = "registry:register:"
+)
+
+// Policy decides whether req may perform action on service. service is empty
+// for reads that span every service.
+type Policy func(req *http.Request, action Action, service string) bool
+
+// WithPolicy protects the HTTP API with p. Without a policy every request is
+// allowed.
+func WithPolicy(p Policy) Option {
+	return func(r *Registry) { r.policy = p }
+}
+
+// ScopePolicy authorises requests by the scopes of the platform JWT, or by a
+// verified TLS client certificate whose common name is the service it may
+// write:
+//
+//   - registry:admin allows everything;
+//   - registry:register:<name> allows writing <name> and reading;
+//   - registry:read, or any verified client certificate, allows reading.
+//
+// With anonymousRead, reads need no credentials at all.
+func ScopePolicy(anonymousRead bool) Policy {
+	return func(req *http.Request, action Action, service string) bool {
+		scopes, _ := tokenScopes(req)
+		if slices.Contains(scopes, ScopeAdmin) {
+			return true
+		}
+		cn := clientCertName(req)
+		if action == ActionRead {
+			if anonymousRead || cn != "" || slices.Contains(scopes, ScopeRead) {
+				return true
+			}
+			return slices.ContainsFunc(scopes, func(s string) bool { return strings.HasPrefix(s, ScopeRegisterPrefix) })
+		}
+		return service != "" && (cn == service ||
+			slices.Contains(scopes, ScopeRegisterPrefix+service) ||
+			slices.Contains(scopes, ScopeRegisterPrefix+"*"))
+	}
+}
+
+// AuthMiddleware validates the bearer token of requests that carry one,
+// rejecting invalid tokens and those not issued for the registry
+// (security.AudienceRegistry), such as users' tokens for the services. Requests
+// without a token pass through so that a Policy can still accept them on the
+// strength of a client certificate.
+func AuthMiddleware(next http.Handler) http.Handler {
+	validated := security.JWTAudienceMiddleware(next, security.AudienceRegistry)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "" {
+			validated.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// authorize answers 401 or 403 and returns false when the policy rejects the
+// request.
+func (r *Registry) authorize(w http.ResponseWriter, req *http.Request, action Action, service string) bool {
+	if r.policy == nil || r.policy(req, action, service) {
+		return true
+	}
+	if _, ok := tokenScopes(req); !ok && clientCertName(req) == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="registry"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// tokenScopes returns the scopes of the validated token, and false when the
+// request carries none.
+func tokenScopes(req *http.Request) ([]string, bool) {
+	claims, ok := req.Context().Value("user").(jwt.MapClaims)
+	if !ok {
+		return nil, false
+	}
+	scope, _ := claims["scope"].(string)
+	return strings.Fields(scope), true
+}
+
+// clientCertName returns the common name of a verified client certificate.
+func clientCertName(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return req.TLS.VerifiedChains[0][0].Subject.CommonName
+}
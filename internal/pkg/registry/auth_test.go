@@ -0,0 +1,211 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/moodykhalif23/scalebit/internal/pkg/security"
+)
+
+// signedToken returns a registry token with claims, signed with JWT_SECRET.
+func signedToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	if _, ok := claims["aud"]; !ok {
+		claims["aud"] = security.AudienceRegistry
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestScopePolicy(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	r := newTestRegistry(t, WithPolicy(ScopePolicy(false)))
+	existing, _, _ := r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	srv := httptest.NewServer(AuthMiddleware(r.Handler()))
+	defer srv.Close()
+
+	register := []byte(`{"service": "orders", "address": "http://10.0.0.2:8082"}`)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"register without a token", http.MethodPost, "/register", "", http.StatusUnauthorized},
+		{"register with an invalid token", http.MethodPost, "/register", "not-a-jwt", http.StatusUnauthorized},
+		{"register with read scope", http.MethodPost, "/register", signedToken(t, jwt.MapClaims{"scope": ScopeRead}), http.StatusForbidden},
+		{"register with the admin role only", http.MethodPost, "/register", signedToken(t, jwt.MapClaims{"role": "admin"}), http.StatusForbidden},
+		{"register another service", http.MethodPost, "/register", signedToken(t, jwt.MapClaims{"scope": ScopeRegisterPrefix + "billing"}), http.StatusForbidden},
+		{"register with a user's token", http.MethodPost, "/register", signedToken(t, jwt.MapClaims{"aud": security.AudienceAPI, "scope": ScopeAdmin}), http.StatusUnauthorized},
+		{"register own service", http.MethodPost, "/register", signedToken(t, jwt.MapClaims{"scope": ScopeRegisterPrefix + "orders"}), http.StatusCreated},
+		{"list without a token", http.MethodGet, "/services/orders", "", http.StatusUnauthorized},
+		{"list with register scope", http.MethodGet, "/services/orders", signedToken(t, jwt.MapClaims{"scope": ScopeRegisterPrefix + "billing"}), http.StatusOK},
+		{"deregister without a token", http.MethodDelete, "/services/orders/" + existing.ID, "", http.StatusUnauthorized},
+		{"deregister with read scope", http.MethodDelete, "/services/orders/" + existing.ID, signedToken(t, jwt.MapClaims{"scope": ScopeRead}), http.StatusForbidden},
+		{"deregister with the admin role only", http.MethodDelete, "/services/orders/" + existing.ID, signedToken(t, jwt.MapClaims{"role": "admin"}), http.StatusForbidden},
+		{"deregister with admin scope", http.MethodDelete, "/services/orders/" + existing.ID, signedToken(t, jwt.MapClaims{"scope": ScopeAdmin}), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, bytes.NewReader(register))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("got %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.token == "" && tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestScopePolicyAnonymousRead(t *testing.T) {
+	r := newTestRegistry(t, WithPolicy(ScopePolicy(true)))
+	r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	srv := httptest.NewServer(AuthMiddleware(r.Handler()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/services/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("anonymous read: got %d, want 200", resp.StatusCode)
+	}
+	resp = postJSON(t, srv.URL+"/register", map[string]string{"service": "orders", "address": "http://10.0.0.2:8082"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous register: got %d, want 401", resp.StatusCode)
+	}
+}
+
+// testCA issues client certificates for TestClientCertificatePolicy.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a client certificate for name.
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertificatePolicy(t *testing.T) {
+	r := newTestRegistry(t, WithPolicy(ScopePolicy(false)))
+	existing, _, _ := r.Register(Service{Name: "billing", Address: "http://10.0.0.9:8083"})
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv := httptest.NewUnstartedServer(AuthMiddleware(r.Handler()))
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		transport := srv.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		return &http.Client{Transport: transport}
+	}
+	orders := client(ca.issue(t, "orders"))
+	anonymous := client()
+	untrusted := client(newTestCA(t).issue(t, "orders"))
+
+	do := func(c *http.Client, method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			// A certificate the server cannot verify fails the handshake.
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	register := func(service string) string {
+		return `{"service": "` + service + `", "address": "http://10.0.0.1:8082"}`
+	}
+	for _, tt := range []struct {
+		name   string
+		client *http.Client
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"register own service", orders, http.MethodPost, "/register", register("orders"), http.StatusCreated},
+		{"register another service", orders, http.MethodPost, "/register", register("billing"), http.StatusForbidden},
+		{"read", orders, http.MethodGet, "/services/billing", "", http.StatusOK},
+		{"deregister another service", orders, http.MethodDelete, "/services/billing/" + existing.ID, "", http.StatusForbidden},
+		{"register without a certificate", anonymous, http.MethodPost, "/register", register("orders"), http.StatusUnauthorized},
+		{"certificate from another CA", untrusted, http.MethodPost, "/register", register("orders"), 0},
+	} {
+		if got := do(tt.client, tt.method, tt.path, tt.body); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
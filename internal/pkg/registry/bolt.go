@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var instancesBucket = []byte("instances")
+
+// BoltStore keeps instances in an embedded bbolt database file, one JSON
+// value per instance keyed by "<name>/<id>".
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens or creates the database at path.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open registry store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(instancesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (b *BoltStore) Load() ([]Service, error) {
+	var out []Service
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(instancesBucket).ForEach(func(k, v []byte) error {
+			var s Service
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("decode instance %s: %w", k, err)
+			}
+			out = append(out, s)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (b *BoltStore) Put(s Service) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(instancesBucket).Put([]byte(storeKey(s.Name, s.ID)), data)
+	})
+}
+
+func (b *BoltStore) Delete(name, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(instancesBucket).Delete([]byte(storeKey(name, id)))
+	})
+}
+
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,224 @@
+// Package client lets services register themselves with the service registry
+// and discover their peers through it.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+)
+
+// ErrNotFound is returned when the registry does not know an instance or
+// service.
+var ErrNotFound = errors.New("registry client: not found")
+
+const (
+	// requestTimeout bounds each request to a registry node.
+	requestTimeout = 10 * time.Second
+	// blockingWait is how long a blocking query waits for a change. It is
+	// bounded by blockingWait plus requestTimeout.
+	blockingWait = 5 * time.Minute
+)
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to talk to the registry. It
+// replaces WithTLSConfig. Its Timeout should be zero: the client bounds each
+// request itself, and blocking queries outlast any short client-wide timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithToken sends token as a bearer token, for registries with access
+// control.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithTLSConfig sets the TLS configuration for https registry URLs, e.g. a
+// client certificate for mutual TLS.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) { c.tlsConfig = cfg }
+}
+
+// WithStrategy sets how Pick chooses among healthy instances; RoundRobin by
+// default.
+func WithStrategy(s Strategy) Option {
+	return func(c *Client) { c.strategy = s }
+}
+
+// Client talks to one registry, or to the nodes of a replicated one, which
+// it tries in turn.
+type Client struct {
+	urls      []string
+	http      *http.Client
+	token     string
+	tlsConfig *tls.Config
+	strategy  Strategy
+
+	mu      sync.Mutex
+	next    int // index into urls of the node to try first
+	watches map[string]*watch
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// New creates a client for the registry at baseURLs. Several URLs, e.g. the
+// nodes of a replicated registry, are tried in order until one answers.
+func New(baseURLs []string, opts ...Option) (*Client, error) {
+	if len(baseURLs) == 0 {
+		return nil, fmt.Errorf("registry client: no registry URL")
+	}
+	c := &Client{
+		strategy: RoundRobin,
+		watches:  make(map[string]*watch),
+	}
+	for _, u := range baseURLs {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return nil, fmt.Errorf("registry client: invalid URL %q: %w", u, err)
+		}
+		c.urls = append(c.urls, strings.TrimSuffix(u, "/"))
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.http == nil {
+		c.http = &http.Client{
+			// Followers redirect writes to the leader, another node of the
+			// same registry, which needs the token as well.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				if auth := via[0].Header.Get("Authorization"); auth != "" {
+					req.Header.Set("Authorization", auth)
+				}
+				return nil
+			},
+		}
+		if c.tlsConfig != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = c.tlsConfig
+			c.http.Transport = transport
+		}
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// Close stops the background refresh of discovered services.
+func (c *Client) Close() {
+	c.cancel()
+}
+
+// do sends a request to the first registry node that answers and decodes a
+// JSON response into out. Followers redirect writes to the leader, which the
+// HTTP client follows since bodies are replayable. Each node gets timeout to
+// answer.
+func (c *Client) do(ctx context.Context, timeout time.Duration, method, path string, in, out interface{}) (http.Header, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	start := c.next
+	c.mu.Unlock()
+
+	var lastErr error
+	for i := range c.urls {
+		n := (start + i) % len(c.urls)
+		resp, header, err := c.try(ctx, timeout, method, c.urls[n]+path, body, in != nil, out)
+		if resp == nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			lastErr = err
+			continue
+		}
+		c.mu.Lock()
+		c.next = n
+		c.mu.Unlock()
+		return header, err
+	}
+	return nil, lastErr
+}
+
+// try sends one request to one node within timeout. It returns a nil
+// response when the node could not be reached.
+func (c *Client) try(ctx context.Context, timeout time.Duration, method, url string, body []byte, isJSON bool, out interface{}) (*http.Response, http.Header, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if isJSON {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := decode(resp, method, req.URL.Path, out)
+	return resp, header, err
+}
+
+func decode(resp *http.Response, method, path string, out interface{}) (http.Header, error) {
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return resp.Header, ErrNotFound
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.Header, fmt.Errorf("registry: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	case out != nil && resp.StatusCode != http.StatusNoContent:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.Header, fmt.Errorf("registry: decode %s %s: %w", method, path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// instances fetches the instances of name. With block, it waits for the
+// registry's index to move from index, even from 0 on a registry that has
+// not seen any change yet.
+func (c *Client) instances(ctx context.Context, name string, index uint64, block bool) ([]registry.Service, uint64, error) {
+	path := "/services/" + url.PathEscape(name)
+	timeout := requestTimeout
+	if block {
+		path += fmt.Sprintf("?index=%d&wait=%s", index, blockingWait)
+		timeout += blockingWait
+	}
+	var out []registry.Service
+	header, err := c.do(ctx, timeout, http.MethodGet, path, nil, &out)
+	if header != nil {
+		fmt.Sscan(header.Get("X-Registry-Index"), &index)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, index, nil
+	}
+	return out, index, err
+}
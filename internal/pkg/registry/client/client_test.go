@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+)
+
+// newServer serves h until the end of the test. It is closed after the
+// clients created later, whose blocking queries would otherwise hold it open.
+func newServer(t *testing.T, h http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newRegistry(t *testing.T) *registry.Registry {
+	t.Helper()
+	r, err := registry.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func newClient(t *testing.T, urls []string, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(urls, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// waitFor polls Resolve until name has want instances.
+func waitFor(t *testing.T, c *Client, name string, want int) []registry.Service {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		instances, err := c.Resolve(context.Background(), name)
+		if err == nil && len(instances) == want || time.Now().After(deadline) {
+			if len(instances) != want {
+				t.Fatalf("Resolve(%s) = %d instances, %v; want %d", name, len(instances), err, want)
+			}
+			return instances
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRegisterAndDeregister(t *testing.T) {
+	r := newRegistry(t)
+	srv := newServer(t, r.Handler())
+	c := newClient(t, []string{srv.URL})
+
+	reg, err := c.Register(context.Background(), registry.Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instances, _ := r.Instances("orders"); len(instances) != 1 || instances[0].ID != reg.Instance().ID {
+		t.Fatalf("registry holds %+v after Register", instances)
+	}
+	if err := reg.Deregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if instances, _ := r.Instances("orders"); len(instances) != 0 {
+		t.Errorf("registry holds %+v after Deregister", instances)
+	}
+}
+
+func TestTriesNextNode(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	r := newRegistry(t)
+	r.Register(registry.Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	srv := newServer(t, r.Handler())
+
+	c := newClient(t, []string{down.URL, srv.URL})
+	waitFor(t, c, "orders", 1)
+}
+
+func TestResolveFollowsChanges(t *testing.T) {
+	r := newRegistry(t)
+	r.Register(registry.Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	srv := newServer(t, r.Handler())
+	c := newClient(t, []string{srv.URL})
+
+	waitFor(t, c, "orders", 1)
+	r.Register(registry.Service{Name: "orders", Address: "http://10.0.0.2:8082"})
+	waitFor(t, c, "orders", 2)
+}
+
+func TestResolveWaitsOnEmptyRegistry(t *testing.T) {
+	r := newRegistry(t)
+	var requests atomic.Int32
+	srv := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		r.Handler().ServeHTTP(w, req)
+	}))
+	c := newClient(t, []string{srv.URL})
+
+	// The registry answers index 0 until its first change.
+	waitFor(t, c, "orders", 0)
+	time.Sleep(200 * time.Millisecond)
+	if n := requests.Load(); n > 2 {
+		t.Fatalf("the client sent %d requests to an unchanged registry, want a fetch and a blocking query", n)
+	}
+	r.Register(registry.Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	waitFor(t, c, "orders", 1)
+}
+
+func TestResolveFollowsRestartedRegistry(t *testing.T) {
+	old := newRegistry(t)
+	for _, addr := range []string{"http://10.0.0.1:8082", "http://10.0.0.2:8082", "http://10.0.0.3:8082"} {
+		old.Register(registry.Service{Name: "orders", Address: addr})
+	}
+	var handler atomic.Value
+	handler.Store(old.Handler())
+	srv := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.Load().(http.Handler).ServeHTTP(w, req)
+	}))
+	c := newClient(t, []string{srv.URL})
+	waitFor(t, c, "orders", 3)
+
+	// The restarted registry's index starts over below the one the client
+	// is waiting on.
+	restarted := newRegistry(t)
+	restarted.Register(registry.Service{Name: "orders", Address: "http://10.0.0.4:8082"})
+	handler.Store(restarted.Handler())
+	srv.CloseClientConnections()
+
+	waitFor(t, c, "orders", 1)
+	restarted.Register(registry.Service{Name: "orders", Address: "http://10.0.0.5:8082"})
+	waitFor(t, c, "orders", 2)
+}
+
+// deadlineTransport records the deadline of each request's context.
+type deadlineTransport struct {
+	mu        sync.Mutex
+	deadlines map[string]time.Duration // by raw query
+}
+
+func (d *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if deadline, ok := req.Context().Deadline(); ok {
+		d.mu.Lock()
+		d.deadlines[req.URL.RawQuery] = time.Until(deadline)
+		d.mu.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestBlockingQueriesOutlastRequestTimeout(t *testing.T) {
+	r := newRegistry(t)
+	r.Register(registry.Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	srv := newServer(t, r.Handler())
+	transport := &deadlineTransport{deadlines: map[string]time.Duration{}}
+	c := newClient(t, []string{srv.URL}, WithHTTPClient(&http.Client{Transport: transport}))
+
+	waitFor(t, c, "orders", 1)
+	r.Register(registry.Service{Name: "orders", Address: "http://10.0.0.2:8082"})
+	waitFor(t, c, "orders", 2)
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if d := transport.deadlines[""]; d <= 0 || d > requestTimeout {
+		t.Errorf("plain query deadline %v, want at most %v", d, requestTimeout)
+	}
+	if d := transport.deadlines["index=1&wait=5m0s"]; d <= blockingWait {
+		t.Errorf("blocking query deadline %v, want more than its %v wait", d, blockingWait)
+	}
+}
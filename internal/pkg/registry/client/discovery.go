@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+)
+
+// ErrNoInstances is returned by Pick when a service has no healthy instance.
+var ErrNoInstances = errors.New("registry client: no healthy instances")
+
+// Strategy chooses among the healthy instances of a service.
+type Strategy int
+
+const (
+	// RoundRobin cycles through the instances.
+	RoundRobin Strategy = iota
+	// Random picks an instance at random, in proportion to its weight.
+	Random
+	// LeastLoaded picks the instance with the fewest calls in flight from
+	// this client relative to its weight.
+	LeastLoaded
+)
+
+// watch is the cached view of one service, refreshed in the background with
+// blocking queries.
+type watch struct {
+	ready chan struct{}
+	err   error // of the first fetch; only read after ready is closed
+
+	mu        sync.RWMutex
+	instances []registry.Service
+	rr        atomic.Uint64
+	inFlight  sync.Map // instance ID -> *atomic.Int64
+}
+
+// Resolve returns the cached instances of name, UP or not. The first call
+// for a name fetches it from the registry and starts keeping it up to date;
+// later calls never block on the registry.
+func (c *Client) Resolve(ctx context.Context, name string) ([]registry.Service, error) {
+	c.mu.Lock()
+	w, ok := c.watches[name]
+	if !ok {
+		w = &watch{ready: make(chan struct{})}
+		c.watches[name] = w
+		go c.follow(name, w)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if w.err != nil {
+		c.mu.Lock()
+		if c.watches[name] == w {
+			delete(c.watches, name)
+		}
+		c.mu.Unlock()
+		return nil, w.err
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return append([]registry.Service(nil), w.instances...), nil
+}
+
+// follow keeps w current until the client is closed. The cached list is kept
+// while the registry is unreachable.
+func (c *Client) follow(name string, w *watch) {
+	instances, index, err := c.instances(c.ctx, name, 0, false)
+	w.instances, w.err = instances, err
+	close(w.ready)
+	if err != nil {
+		return
+	}
+
+	backoff := time.Second
+	for c.ctx.Err() == nil {
+		instances, next, err := c.instances(c.ctx, name, index, true)
+		if err != nil {
+			select {
+			case <-c.ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+		// A node whose index is behind ours, e.g. another node or a restarted
+		// one, answers at once with its own index, which is what we wait on
+		// from then on.
+		index = next
+		w.mu.Lock()
+		w.instances = instances
+		w.mu.Unlock()
+	}
+}
+
+// Pick chooses a healthy instance of name with the client's strategy. done
+// must be called when the call to the instance has finished.
+func (c *Client) Pick(ctx context.Context, name string) (inst registry.Service, done func(), err error) {
+	all, err := c.Resolve(ctx, name)
+	if err != nil {
+		return registry.Service{}, nil, err
+	}
+	var up []registry.Service
+	for _, s := range all {
+		if s.Status == registry.StatusUp {
+			up = append(up, s)
+		}
+	}
+	if len(up) == 0 {
+		return registry.Service{}, nil, ErrNoInstances
+	}
+
+	c.mu.Lock()
+	w := c.watches[name]
+	c.mu.Unlock()
+
+	switch c.strategy {
+	case Random:
+		inst = pickRandom(up)
+	case LeastLoaded:
+		inst = w.pickLeastLoaded(up)
+	default:
+		inst = up[int(w.rr.Add(1)-1)%len(up)]
+	}
+	n := w.counter(inst.ID)
+	n.Add(1)
+	var once sync.Once
+	return inst, func() { once.Do(func() { n.Add(-1) }) }, nil
+}
+
+func pickRandom(up []registry.Service) registry.Service {
+	total := 0
+	for _, s := range up {
+		total += max(s.Weight, 1)
+	}
+	n := rand.IntN(total)
+	for _, s := range up {
+		if n -= max(s.Weight, 1); n < 0 {
+			return s
+		}
+	}
+	return up[len(up)-1]
+}
+
+func (w *watch) pickLeastLoaded(up []registry.Service) registry.Service {
+	best, bestLoad := up[0], -1.0
+	for _, s := range up {
+		load := float64(w.counter(s.ID).Load()) / float64(max(s.Weight, 1))
+		if bestLoad < 0 || load < bestLoad {
+			best, bestLoad = s, load
+		}
+	}
+	return best
+}
+
+func (w *watch) counter(id string) *atomic.Int64 {
+	n, _ := w.inFlight.LoadOrStore(id, new(atomic.Int64))
+	return n.(*atomic.Int64)
+}
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+)
+
+const (
+	defaultTTL = 30 * time.Second
+	// retryInterval is how soon a failed registration is retried.
+	retryInterval = 5 * time.Second
+)
+
+// Registration keeps one instance registered until Deregister is called.
+type Registration struct {
+	client *Client
+	inst   registry.Service
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu         sync.Mutex
+	registered bool
+}
+
+// Register registers inst and heartbeats it in the background every third
+// of its TTL, registering it again whenever the registry has forgotten it.
+// A TTL of zero defaults to 30s. The returned Registration is always
+// running; a non-nil error only means the first attempt failed and is being
+// retried.
+func (c *Client) Register(ctx context.Context, inst registry.Service) (*Registration, error) {
+	if inst.TTL == 0 {
+		inst.TTL = registry.Duration(defaultTTL)
+	}
+	loopCtx, cancel := context.WithCancel(context.Background())
+	reg := &Registration{client: c, inst: inst, cancel: cancel, done: make(chan struct{})}
+	err := reg.register(ctx)
+	go reg.loop(loopCtx)
+	return reg, err
+}
+
+// Instance returns the instance as last stored by the registry.
+func (r *Registration) Instance() registry.Service {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inst
+}
+
+func (r *Registration) register(ctx context.Context) error {
+	r.mu.Lock()
+	inst := r.inst
+	r.mu.Unlock()
+
+	var out registry.Service
+	_, err := r.client.do(ctx, requestTimeout, http.MethodPost, "/register", map[string]interface{}{
+		"service": inst.Name,
+		"id":      inst.ID,
+		"address": inst.Address,
+		"version": inst.Version,
+		"tags":    inst.Tags,
+		"zone":    inst.Zone,
+		"weight":  inst.Weight,
+		"ttl":     inst.TTL,
+		"check":   inst.Check,
+	}, &out)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered = err == nil
+	if err == nil {
+		r.inst = out
+	}
+	return err
+}
+
+func (r *Registration) heartbeat(ctx context.Context) error {
+	r.mu.Lock()
+	path := "/services/" + url.PathEscape(r.inst.Name) + "/" + url.PathEscape(r.inst.ID) + "/heartbeat"
+	r.mu.Unlock()
+	_, err := r.client.do(ctx, requestTimeout, http.MethodPut, path, nil, nil)
+	return err
+}
+
+func (r *Registration) loop(ctx context.Context) {
+	defer close(r.done)
+	interval := time.Duration(r.inst.TTL) / 3
+	for {
+		r.mu.Lock()
+		wait := interval
+		if !r.registered {
+			wait = min(interval, retryInterval)
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		r.mu.Lock()
+		registered := r.registered
+		r.mu.Unlock()
+		if registered {
+			err := r.heartbeat(ctx)
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Registry heartbeat failed: %v", err)
+				continue
+			}
+			// Evicted, e.g. after a registry restart or a long pause.
+		}
+		if err := r.register(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Registry registration failed: %v", err)
+		}
+	}
+}
+
+// Deregister stops heartbeating and removes the instance from the registry.
+// It is safe to call on a nil Registration.
+func (r *Registration) Deregister(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.cancel()
+	<-r.done
+	r.mu.Lock()
+	path := "/services/" + url.PathEscape(r.inst.Name) + "/" + url.PathEscape(r.inst.ID)
+	r.mu.Unlock()
+	_, err := r.client.do(ctx, requestTimeout, http.MethodDelete, path, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// RegisterFromEnv registers the calling service as name, listening on port,
+// with the registry named by REGISTRY_URL (comma-separated for a replicated
+// registry). It returns nil when REGISTRY_URL is unset. The address is
+// SERVICE_ADDRESS, or http://$POD_IP:port, or http://<hostname>:port;
+// SERVICE_VERSION, SERVICE_ZONE and REGISTRY_TTL are passed on when set.
+// REGISTRY_TOKEN is sent as bearer token, and REGISTRY_CA_FILE,
+// REGISTRY_CERT_FILE and REGISTRY_KEY_FILE configure (mutual) TLS.
+// Registration failures are logged and retried in the background.
+func RegisterFromEnv(ctx context.Context, name, port string) *Registration {
+	urls := os.Getenv("REGISTRY_URL")
+	if urls == "" {
+		return nil
+	}
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		log.Printf("Registry disabled: %v", err)
+		return nil
+	}
+	c, err := New(strings.Split(urls, ","), opts...)
+	if err != nil {
+		log.Printf("Registry disabled: %v", err)
+		return nil
+	}
+	inst := registry.Service{
+		Name:    name,
+		Address: AddressFromEnv(port),
+		Version: os.Getenv("SERVICE_VERSION"),
+		Zone:    os.Getenv("SERVICE_ZONE"),
+	}
+	if v := os.Getenv("REGISTRY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("Ignoring invalid REGISTRY_TTL %q: %v", v, err)
+		} else {
+			inst.TTL = registry.Duration(ttl)
+		}
+	}
+	reg, err := c.Register(ctx, inst)
+	if err != nil {
+		log.Printf("Registry registration failed, retrying in the background: %v", err)
+	} else {
+		log.Printf("Registered %s at %s as %s", name, inst.Address, reg.Instance().ID)
+	}
+	return reg
+}
+
+// AddressFromEnv returns the address other services should use to reach this
+// process on port; see RegisterFromEnv.
+func AddressFromEnv(port string) string {
+	if addr := os.Getenv("SERVICE_ADDRESS"); addr != "" {
+		return addr
+	}
+	host := os.Getenv("POD_IP")
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// OptionsFromEnv returns the options for the credentials documented on
+// RegisterFromEnv.
+func OptionsFromEnv() ([]Option, error) {
+	var opts []Option
+	if token := os.Getenv("REGISTRY_TOKEN"); token != "" {
+		opts = append(opts, WithToken(token))
+	}
+	caFile, certFile, keyFile := os.Getenv("REGISTRY_CA_FILE"), os.Getenv("REGISTRY_CERT_FILE"), os.Getenv("REGISTRY_KEY_FILE")
+	if caFile == "" && certFile == "" {
+		return opts, nil
+	}
+	cfg := &tls.Config{}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return append(opts, WithTLSConfig(cfg)), nil
+}
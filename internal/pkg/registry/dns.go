@@ -0,0 +1,376 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// maxUDPSize is the largest UDP answer without EDNS0 (RFC 1035) and
+	// maxEDNSSize the largest we send with it.
+	maxUDPSize  = 512
+	maxEDNSSize = 4096
+	// tcpIdleTimeout closes DNS-over-TCP connections that stay quiet.
+	tcpIdleTimeout = 10 * time.Second
+)
+
+// DNSServer answers DNS queries for the healthy (UP) instances of registered
+// services, below the zone service.<domain>:
+//
+//	<name>.service.<domain>        A and AAAA of every instance, and SRV
+//	_<name>._tcp.service.<domain>  SRV of every instance (RFC 2782 form)
+//	<id>.<name>.service.<domain>   A and AAAA of one instance
+//
+// SRV records point at the instance's host name, or at its <id> name with
+// the address in the additional section when the instance registered an IP.
+// IDs that are not a DNS label, such as those with dots, are named by a hash
+// of the ID instead (see instanceLabel).
+// Unknown services get NXDOMAIN and names outside the zone are refused.
+type DNSServer struct {
+	reg  *Registry
+	zone string
+	ttl  uint32
+}
+
+// NewDNSServer serves r under service.<domain> with records valid for ttl.
+func NewDNSServer(r *Registry, domain string, ttl time.Duration) *DNSServer {
+	domain = strings.Trim(strings.ToLower(domain), ".")
+	return &DNSServer{reg: r, zone: "service." + domain + ".", ttl: uint32(ttl / time.Second)}
+}
+
+// ListenAndServe answers queries over UDP and TCP on addr until ctx is done.
+func (d *DNSServer) ListenAndServe(ctx context.Context, addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+		ln.Close()
+	}()
+
+	errc := make(chan error, 2)
+	go func() { errc <- d.serveUDP(pc) }()
+	go func() { errc <- d.serveTCP(ln) }()
+	err = <-errc
+	pc.Close()
+	ln.Close()
+	<-errc
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (d *DNSServer) serveUDP(pc net.PacketConn) error {
+	for {
+		buf := make([]byte, maxEDNSSize)
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		go func() {
+			resp, err := d.answer(buf[:n], true)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(resp, from)
+		}()
+	}
+}
+
+func (d *DNSServer) serveTCP(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go d.serveTCPConn(conn)
+	}
+}
+
+// serveTCPConn handles length-prefixed messages (RFC 1035 4.2.2) until the
+// client closes the connection or stays idle.
+func (d *DNSServer) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		resp, err := d.answer(query, false)
+		if err != nil {
+			return
+		}
+		out := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(resp)), uint16(len(resp)))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// record is one answer before encoding.
+type record struct {
+	name   string
+	ip     net.IP
+	port   uint16
+	weight uint16
+	target string // SRV target; SRV records only
+}
+
+// answer builds the response to one query message. Over UDP it sets the TC
+// bit instead of exceeding what the client can receive.
+func (d *DNSServer) answer(query []byte, udp bool) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	if h.Response {
+		return nil, errors.New("dns: not a query")
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, err
+	}
+	limit, edns := maxUDPSize, false
+	if err := p.SkipAllAnswers(); err == nil && p.SkipAllAuthorities() == nil {
+		for {
+			rh, err := p.AdditionalHeader()
+			if err != nil {
+				break
+			}
+			if rh.Type == dnsmessage.TypeOPT {
+				edns = true
+				limit = min(max(int(rh.Class), maxUDPSize), maxEDNSSize)
+			}
+			if p.SkipAdditional() != nil {
+				break
+			}
+		}
+	}
+
+	resp := dnsmessage.Header{
+		ID:               h.ID,
+		Response:         true,
+		OpCode:           h.OpCode,
+		Authoritative:    true,
+		RecursionDesired: h.RecursionDesired,
+	}
+	var answers, extra []record
+	switch {
+	case h.OpCode != 0:
+		resp.RCode = dnsmessage.RCodeNotImplemented
+	case len(questions) != 1:
+		resp.RCode = dnsmessage.RCodeFormatError
+	default:
+		answers, extra, resp.RCode = d.lookup(questions[0])
+	}
+
+	msg, err := d.build(resp, questions, answers, extra, edns)
+	if err == nil && udp && len(msg) > limit {
+		resp.Truncated = true
+		msg, err = d.build(resp, questions, nil, nil, edns)
+	}
+	return msg, err
+}
+
+func (d *DNSServer) lookup(q dnsmessage.Question) (answers, extra []record, rcode dnsmessage.RCode) {
+	if q.Class != dnsmessage.ClassINET && q.Class != dnsmessage.ClassANY {
+		return nil, nil, dnsmessage.RCodeRefused
+	}
+	name := strings.ToLower(q.Name.String())
+	if name != d.zone && !strings.HasSuffix(name, "."+d.zone) {
+		return nil, nil, dnsmessage.RCodeRefused
+	}
+	if name == d.zone {
+		return nil, nil, dnsmessage.RCodeSuccess
+	}
+	labels := strings.Split(strings.TrimSuffix(strings.TrimSuffix(name, d.zone), "."), ".")
+
+	var service, id string
+	wantSRV := q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL
+	wantIP := q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeAAAA || q.Type == dnsmessage.TypeALL
+	switch {
+	case len(labels) == 2 && strings.HasPrefix(labels[0], "_") && labels[1] == "_tcp":
+		service, wantIP = labels[0][1:], false
+	case len(labels) == 1 && labels[0] != "":
+		service = labels[0]
+	case len(labels) == 2:
+		id, service, wantSRV = labels[0], labels[1], false
+	default:
+		return nil, nil, dnsmessage.RCodeNameError
+	}
+
+	instances, ok := d.reg.Instances(service)
+	if !ok {
+		return nil, nil, dnsmessage.RCodeNameError
+	}
+	found := id == ""
+	for _, inst := range instances {
+		if id != "" && instanceLabel(inst.ID) != id {
+			continue
+		}
+		found = true
+		if inst.Status != StatusUp {
+			continue
+		}
+		host, port := endpoint(inst.Address)
+		ip := net.ParseIP(host)
+		if wantIP && ip != nil && ipMatches(ip, q.Type) {
+			answers = append(answers, record{name: name, ip: ip})
+		}
+		if wantSRV {
+			target := dnsName(host)
+			if ip != nil {
+				target = instanceLabel(inst.ID) + "." + service + "." + d.zone
+				extra = append(extra, record{name: target, ip: ip})
+			}
+			answers = append(answers, record{
+				name:   name,
+				port:   port,
+				weight: uint16(min(max(inst.Weight, 1), 65535)),
+				target: target,
+			})
+		}
+	}
+	if !found {
+		return nil, nil, dnsmessage.RCodeNameError
+	}
+	// Spread clients that only use the first address.
+	rand.Shuffle(len(answers), func(i, j int) { answers[i], answers[j] = answers[j], answers[i] })
+	return answers, extra, dnsmessage.RCodeSuccess
+}
+
+func (d *DNSServer) build(h dnsmessage.Header, questions []dnsmessage.Question, answers, extra []record, edns bool) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, maxUDPSize), h)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, q := range questions {
+		if err := b.Question(q); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, rec := range answers {
+		if err := d.writeRecord(&b, rec); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	for _, rec := range extra {
+		if err := d.writeRecord(&b, rec); err != nil {
+			return nil, err
+		}
+	}
+	if edns {
+		var rh dnsmessage.ResourceHeader
+		if err := rh.SetEDNS0(maxEDNSSize, dnsmessage.RCodeSuccess, false); err != nil {
+			return nil, err
+		}
+		if err := b.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+func (d *DNSServer) writeRecord(b *dnsmessage.Builder, rec record) error {
+	name, err := dnsmessage.NewName(rec.name)
+	if err != nil {
+		return err
+	}
+	rh := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: d.ttl}
+	switch {
+	case rec.target != "":
+		target, err := dnsmessage.NewName(rec.target)
+		if err != nil {
+			return err
+		}
+		return b.SRVResource(rh, dnsmessage.SRVResource{Priority: 1, Weight: rec.weight, Port: rec.port, Target: target})
+	case rec.ip.To4() != nil:
+		var a dnsmessage.AResource
+		copy(a.A[:], rec.ip.To4())
+		return b.AResource(rh, a)
+	default:
+		var aaaa dnsmessage.AAAAResource
+		copy(aaaa.AAAA[:], rec.ip.To16())
+		return b.AAAAResource(rh, aaaa)
+	}
+}
+
+func ipMatches(ip net.IP, t dnsmessage.Type) bool {
+	switch t {
+	case dnsmessage.TypeA:
+		return ip.To4() != nil
+	case dnsmessage.TypeAAAA:
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// endpoint splits an instance address such as "http://10.0.0.7:8082" or
+// "10.0.0.7:50051" into host and port, defaulting the port from the scheme.
+func endpoint(address string) (string, uint16) {
+	hp := hostPort(address)
+	host, portStr, err := net.SplitHostPort(hp)
+	if err != nil {
+		host = strings.Trim(hp, "[]")
+		if u, err := url.Parse(address); err == nil && u.Scheme == "https" {
+			return host, 443
+		}
+		return host, 80
+	}
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+	return host, uint16(port)
+}
+
+// instanceLabel returns the DNS label of an instance ID: the ID in lower
+// case, or "id-" and a hash of it when the ID is empty, longer than 63 bytes
+// or contains dots or other characters that do not belong in a label.
+func instanceLabel(id string) string {
+	label := strings.ToLower(id)
+	valid := len(label) > 0 && len(label) <= 63
+	for i := 0; valid && i < len(label); i++ {
+		c := label[i]
+		valid = c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+	}
+	if valid {
+		return label
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "id-" + hex.EncodeToString(sum[:])[:16]
+}
+
+func dnsName(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".") + "."
+}
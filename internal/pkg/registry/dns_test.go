@@ -0,0 +1,164 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestResolver serves d on loopback and returns a resolver that sends
+// every query to it, and the count of its connections over TCP.
+func newTestResolver(t *testing.T, d *DNSServer) (*net.Resolver, *atomic.Int32) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+	go d.serveUDP(pc)
+	go d.serveTCP(ln)
+
+	var tcpDials atomic.Int32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			addr := pc.LocalAddr().String()
+			if network == "tcp" {
+				addr = ln.Addr().String()
+				tcpDials.Add(1)
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}, &tcpDials
+}
+
+func TestDNSLookups(t *testing.T) {
+	r := newTestRegistry(t, WithThresholds(1, 1))
+	// Nothing listens on port 1, so this instance goes DOWN.
+	down, _, _ := r.Register(Service{Name: "orders", Address: "http://127.0.0.2:1"})
+	r.CheckHealth(context.Background())
+	if s, _ := r.instance("orders", down.ID); s.Status != StatusDown {
+		t.Fatalf("instance on a closed port is %s after a failed check", s.Status)
+	}
+	a, _, _ := r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082", Weight: 3})
+	r.Register(Service{Name: "orders", Address: "http://10.0.0.2:8082"})
+	r.Register(Service{Name: "orders", Address: "grpc://orders-2.internal:50051"})
+	resolver, _ := newTestResolver(t, NewDNSServer(r, "consul", 30*time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addrs, err := resolver.LookupHost(ctx, "orders.service.consul.")
+	slices.Sort(addrs)
+	if err != nil || !slices.Equal(addrs, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("LookupHost(orders) = %v, %v; want the UP instances with an IP", addrs, err)
+	}
+	addrs, err = resolver.LookupHost(ctx, a.ID+".orders.service.consul.")
+	if err != nil || !slices.Equal(addrs, []string{"10.0.0.1"}) {
+		t.Errorf("LookupHost(%s) = %v, %v", a.ID, addrs, err)
+	}
+	addrs, err = resolver.LookupHost(ctx, down.ID+".orders.service.consul.")
+	if len(addrs) != 0 {
+		t.Errorf("LookupHost of a DOWN instance = %v, %v; want no addresses", addrs, err)
+	}
+
+	_, srvs, err := resolver.LookupSRV(ctx, "orders", "tcp", "service.consul.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, srv := range srvs {
+		got = append(got, fmt.Sprintf("%s:%d/%d", srv.Target, srv.Port, srv.Weight))
+	}
+	slices.Sort(got)
+	want := []string{
+		a.ID + ".orders.service.consul.:8082/3",
+		InstanceID("orders", "http://10.0.0.2:8082") + ".orders.service.consul.:8082/1",
+		"orders-2.internal.:50051/1",
+	}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("LookupSRV(orders) = %v, want %v", got, want)
+	}
+
+	var dnsErr *net.DNSError
+	if _, err := resolver.LookupHost(ctx, "billing.service.consul."); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("LookupHost of an unknown service = %v, want NXDOMAIN", err)
+	}
+	if _, err := resolver.LookupHost(ctx, "example.com."); err == nil {
+		t.Error("a name outside the zone resolved")
+	}
+}
+
+func TestDNSFallsBackToTCP(t *testing.T) {
+	r := newTestRegistry(t)
+	var want []string
+	for i := 1; i <= 120; i++ {
+		addr := fmt.Sprintf("10.0.1.%d", i)
+		r.Register(Service{Name: "orders", Address: "http://" + addr + ":8082"})
+		want = append(want, addr)
+	}
+	resolver, tcpDials := newTestResolver(t, NewDNSServer(r, "consul", 30*time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 120 A records do not fit the resolver's EDNS0 UDP size, so it retries
+	// over TCP after the truncated answer.
+	addrs, err := resolver.LookupHost(ctx, "orders.service.consul.")
+	slices.Sort(addrs)
+	slices.Sort(want)
+	if err != nil || !slices.Equal(addrs, want) {
+		t.Errorf("LookupHost(orders) = %d addresses, %v; want %d", len(addrs), err, len(want))
+	}
+	if tcpDials.Load() == 0 {
+		t.Error("the answer was not truncated over UDP")
+	}
+}
+
+func TestDNSInstanceIDsThatAreNotLabels(t *testing.T) {
+	r := newTestRegistry(t)
+	ids := []string{"orders.eu-west-1", "a..b", strings.Repeat("x", 64), "Orders-1"}
+	for i, id := range ids {
+		r.Register(Service{ID: id, Name: "orders", Address: fmt.Sprintf("http://10.0.0.%d:8082", i+1)})
+	}
+	resolver, _ := newTestResolver(t, NewDNSServer(r, "consul", 30*time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// One bad ID must not fail the answer for the whole service.
+	_, srvs, err := resolver.LookupSRV(ctx, "orders", "tcp", "service.consul.")
+	if err != nil || len(srvs) != len(ids) {
+		t.Fatalf("LookupSRV(orders) = %d records, %v; want %d", len(srvs), err, len(ids))
+	}
+	targets := map[string]bool{}
+	for _, srv := range srvs {
+		targets[srv.Target] = true
+	}
+	for i, id := range ids {
+		target := instanceLabel(id) + ".orders.service.consul."
+		if !targets[target] {
+			t.Errorf("no SRV record for %q at %s", id, target)
+		}
+		// Each target resolves back to its own instance.
+		addrs, err := resolver.LookupHost(ctx, target)
+		if want := fmt.Sprintf("10.0.0.%d", i+1); err != nil || !slices.Equal(addrs, []string{want}) {
+			t.Errorf("LookupHost(%s) = %v, %v; want %s", target, addrs, err, want)
+		}
+	}
+	if instanceLabel("Orders-1") != "orders-1" {
+		t.Errorf("the valid ID Orders-1 is named %s", instanceLabel("Orders-1"))
+	}
+}
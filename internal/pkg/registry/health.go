@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	ProtocolHTTP = "http"
+	ProtocolTCP  = "tcp"
+	ProtocolGRPC = "grpc"
+)
+
+// HealthCheck configures how an instance is probed.
+type HealthCheck struct {
+	// Protocol is "http" (default), "tcp" or "grpc".
+	Protocol string `json:"protocol,omitempty"`
+	// Path is the HTTP path to GET; "/health" if unset.
+	Path string `json:"path,omitempty"`
+	// GRPCService is the service name sent in the gRPC health check request;
+	// empty asks about the server as a whole.
+	GRPCService string `json:"grpcService,omitempty"`
+}
+
+func (c *HealthCheck) protocol() string {
+	if c == nil || c.Protocol == "" {
+		return ProtocolHTTP
+	}
+	return c.Protocol
+}
+
+// Checker probes one instance. A nil error means healthy. Implementations
+// must honour ctx, which carries the per-check timeout.
+type Checker interface {
+	Check(ctx context.Context, inst Service) error
+}
+
+// HTTPChecker expects a 2xx answer to GET <address><path>. Addresses
+// without a scheme, such as "10.0.0.7:8080", are checked over http.
+type HTTPChecker struct {
+	Client *http.Client
+}
+
+func (c *HTTPChecker) Check(ctx context.Context, inst Service) error {
+	path := "/health"
+	if inst.Check != nil && inst.Check.Path != "" {
+		path = inst.Check.Path
+	}
+	address := inst.Address
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("health endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// TCPChecker only checks that a connection can be opened.
+type TCPChecker struct{}
+
+func (TCPChecker) Check(ctx context.Context, inst Service) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", hostPort(inst.Address))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// GRPCChecker uses the standard grpc.health.v1 protocol over plaintext.
+type GRPCChecker struct{}
+
+func (GRPCChecker) Check(ctx context.Context, inst Service) error {
+	conn, err := grpc.NewClient(hostPort(inst.Address), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var service string
+	if inst.Check != nil {
+		service = inst.Check.GRPCService
+	}
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpc health status %s", resp.GetStatus())
+	}
+	return nil
+}
+
+// hostPort strips the scheme from addresses such as "http://host:port".
+func hostPort(address string) string {
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return address
+}
+
+type checkResult struct {
+	name, id, address string
+	at                time.Time
+	err               error
+}
+
+// CheckHealth runs one round of health checks on a pool of workers. Probes
+// run without holding the registry lock; each result is committed under a
+// short lock.
+func (r *Registry) CheckHealth(ctx context.Context) {
+	jobs := make(chan Service)
+	var wg sync.WaitGroup
+	for i := 0; i < r.healthWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for inst := range jobs {
+				r.applyResult(r.check(ctx, inst))
+			}
+		}()
+	}
+
+feed:
+	for _, instances := range r.Services() {
+		for _, inst := range instances {
+			select {
+			case jobs <- inst:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (r *Registry) check(ctx context.Context, inst Service) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, r.healthTimeout)
+	defer cancel()
+	res := checkResult{name: inst.Name, id: inst.ID, address: inst.Address}
+	protocol := inst.Check.protocol()
+	checker, ok := r.checkers[protocol]
+	if !ok {
+		res.err = fmt.Errorf("unknown health check protocol %q", protocol)
+		res.at = r.now()
+		return res
+	}
+	start := time.Now()
+	res.err = checker.Check(ctx, inst)
+	result := "success"
+	if res.err != nil {
+		result = "failure"
+	}
+	telemetry.RegistryHealthCheckDuration.WithLabelValues(inst.Name, protocol, result).Observe(time.Since(start).Seconds())
+	res.at = r.now()
+	return res
+}
+
+// applyResult updates the counters of the checked instance and flips its
+// status once a threshold is crossed. Only the flips are committed: the
+// counters, last check and last error stay on this node, so that a check
+// costs neither a store write nor a Raft log entry. Results for instances
+// that were removed or moved to another address meanwhile are dropped.
+func (r *Registry) applyResult(res checkResult) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	inst, ok := r.instance(res.name, res.id)
+	if !ok || inst.Address != res.address {
+		return
+	}
+	at := res.at
+	before := inst.Status
+	inst.LastCheck = &at
+	if res.err != nil {
+		inst.LastError = res.err.Error()
+		inst.ConsecutiveFailures++
+		inst.ConsecutiveSuccesses = 0
+		if inst.ConsecutiveFailures >= r.failureThreshold {
+			inst.Status = StatusDown
+		}
+	} else {
+		inst.LastError = ""
+		inst.ConsecutiveSuccesses++
+		inst.ConsecutiveFailures = 0
+		if inst.ConsecutiveSuccesses >= r.successThreshold {
+			inst.Status = StatusUp
+		}
+	}
+	r.setHealth(inst)
+	if inst.Status == before {
+		return
+	}
+	if _, err := r.commit(op{Type: opPut, Service: inst}); err != nil {
+		log.Printf("Recording health of %s/%s: %v", inst.Name, inst.ID, err)
+		return
+	}
+	telemetry.RegistryStatusChanges.WithLabelValues(inst.Name, inst.Status).Inc()
+}
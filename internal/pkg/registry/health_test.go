@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPCheckerAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c := &HTTPChecker{Client: srv.Client()}
+
+	for _, address := range []string{srv.URL, strings.TrimPrefix(srv.URL, "http://")} {
+		if err := c.Check(context.Background(), Service{Address: address}); err != nil {
+			t.Errorf("check of %s: %v", address, err)
+		}
+	}
+	if err := c.Check(context.Background(), Service{Address: srv.URL, Check: &HealthCheck{Path: "/ready"}}); err == nil {
+		t.Error("a 404 from the check path passed")
+	}
+}
+
+func TestTCPChecker(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	if err := (TCPChecker{}).Check(context.Background(), Service{Address: "http://" + address}); err != nil {
+		t.Errorf("check of a listening port: %v", err)
+	}
+	l.Close()
+	if err := (TCPChecker{}).Check(context.Background(), Service{Address: address}); err == nil {
+		t.Error("check of a closed port passed")
+	}
+}
+
+func TestCheckHealthThresholds(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	r := newTestRegistry(t, WithThresholds(2, 2))
+	inst, _, _ := r.Register(Service{Name: "orders", Address: strings.TrimPrefix(srv.URL, "http://")})
+
+	status := func() string {
+		s, _ := r.instance("orders", inst.ID)
+		return s.Status
+	}
+	ctx := context.Background()
+	r.CheckHealth(ctx)
+	if status() != StatusUp {
+		t.Fatal("one failure marked the instance DOWN")
+	}
+	r.CheckHealth(ctx)
+	if status() != StatusDown {
+		t.Fatal("two failures left the instance UP")
+	}
+	healthy.Store(true)
+	r.CheckHealth(ctx)
+	if status() != StatusDown {
+		t.Fatal("one success marked the instance UP")
+	}
+	r.CheckHealth(ctx)
+	if status() != StatusUp {
+		t.Fatal("two successes left the instance DOWN")
+	}
+}
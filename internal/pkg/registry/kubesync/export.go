@@ -0,0 +1,192 @@
+package kubesync
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// exportPort is the port exported Services listen on. Each EndpointSlice
+// maps its named "http" port to the instances' real port.
+const exportPort = 80
+
+// exporter publishes registry services without Kubernetes instances as
+// selectorless Services with EndpointSlices listing their UP instances.
+type exporter struct {
+	client.Client
+	reg  *registry.Registry
+	opts Options
+}
+
+var _ manager.Runnable = &exporter{}
+
+// Start syncs on every registry change and every resync period.
+func (e *exporter) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("registry-export")
+	var index uint64
+	for {
+		if e.reg.IsLeader() {
+			if err := e.sync(ctx); err != nil {
+				logger.Error(err, "Failed to export registry services")
+			}
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, e.opts.Resync)
+		index = e.reg.Wait(waitCtx, index)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection is false: the registry's own leadership decides.
+func (e *exporter) NeedLeaderElection() bool { return false }
+
+func (e *exporter) sync(ctx context.Context) error {
+	ns := e.opts.ExportNamespace
+
+	// Services that run in the cluster are not exported, even when their pods
+	// registered themselves and so carry no import tag.
+	var all corev1.ServiceList
+	if err := e.List(ctx, &all); err != nil {
+		return err
+	}
+	inCluster := map[string]bool{}
+	for i := range all.Items {
+		if ownedByMicroservice(&all.Items[i]) {
+			inCluster[all.Items[i].Name] = true
+		}
+	}
+
+	// Group the UP instances of every exportable service by port.
+	desired := map[string]map[int32][]string{}
+	for name, instances := range e.reg.Services() {
+		if inCluster[name] || len(validation.IsDNS1035Label(name)) > 0 || slices.ContainsFunc(instances, func(s registry.Service) bool {
+			return slices.Contains(s.Tags, Tag)
+		}) {
+			continue
+		}
+		byPort := map[int32][]string{}
+		for _, inst := range instances {
+			host, port, ok := splitAddress(inst.Address)
+			if !ok || inst.Status != registry.StatusUp || net.ParseIP(host).To4() == nil {
+				continue
+			}
+			byPort[port] = append(byPort[port], host)
+		}
+		desired[name] = byPort
+	}
+
+	var services corev1.ServiceList
+	if err := e.List(ctx, &services, client.InNamespace(ns), client.MatchingLabels{managedByLabel: managedBy}); err != nil {
+		return err
+	}
+	for _, svc := range services.Items {
+		if _, ok := desired[svc.Name]; !ok {
+			// Its EndpointSlices are garbage collected with it.
+			if err := e.Delete(ctx, &svc); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+
+	for name, byPort := range desired {
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}}
+		err := e.Get(ctx, client.ObjectKeyFromObject(svc), svc)
+		if err == nil && svc.Labels[managedByLabel] != managedBy {
+			// A Service of that name already exists and is not ours.
+			continue
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = controllerutil.CreateOrUpdate(ctx, e.Client, svc, func() error {
+			if svc.Labels == nil {
+				svc.Labels = map[string]string{}
+			}
+			svc.Labels[managedByLabel] = managedBy
+			svc.Spec.Selector = nil
+			svc.Spec.Ports = []corev1.ServicePort{{
+				Name:       "http",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       exportPort,
+				TargetPort: intstr.FromString("http"),
+			}}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("export service %s: %w", name, err)
+		}
+		if err := e.syncSlices(ctx, svc, byPort); err != nil {
+			return fmt.Errorf("export endpoints of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// syncSlices keeps one EndpointSlice per instance port for svc.
+func (e *exporter) syncSlices(ctx context.Context, svc *corev1.Service, byPort map[int32][]string) error {
+	var existing discoveryv1.EndpointSliceList
+	err := e.List(ctx, &existing, client.InNamespace(svc.Namespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: svc.Name, managedByLabel: managedBy})
+	if err != nil {
+		return err
+	}
+	for _, slice := range existing.Items {
+		if len(slice.Ports) == 0 || slice.Ports[0].Port == nil || byPort[*slice.Ports[0].Port] == nil {
+			if err := e.Delete(ctx, &slice); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+
+	for port, hosts := range byPort {
+		sort.Strings(hosts)
+		slice := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{
+			Name:      svc.Name + "-registry-" + itoa(port),
+			Namespace: svc.Namespace,
+		}}
+		_, err := controllerutil.CreateOrUpdate(ctx, e.Client, slice, func() error {
+			if slice.Labels == nil {
+				slice.Labels = map[string]string{}
+			}
+			slice.Labels[discoveryv1.LabelServiceName] = svc.Name
+			slice.Labels[managedByLabel] = managedBy
+			slice.AddressType = discoveryv1.AddressTypeIPv4
+			name, protocol, p := "http", corev1.ProtocolTCP, port
+			slice.Ports = []discoveryv1.EndpointPort{{Name: &name, Protocol: &protocol, Port: &p}}
+			ready := true
+			slice.Endpoints = slice.Endpoints[:0]
+			for _, host := range hosts {
+				slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+					Addresses:  []string{host},
+					Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+				})
+			}
+			return controllerutil.SetControllerReference(svc, slice, e.Scheme())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func itoa(n int32) string {
+	return strconv.Itoa(int(n))
+}
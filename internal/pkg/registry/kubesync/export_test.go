@@ -0,0 +1,103 @@
+package kubesync
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// exported returns the addresses of the EndpointSlice of svc for port, or
+// nil if there is none.
+func exported(t *testing.T, c client.Client, svc string, port int32) []string {
+	t.Helper()
+	var slice discoveryv1.EndpointSlice
+	err := c.Get(context.Background(), client.ObjectKey{Namespace: "registry", Name: svc + "-registry-" + itoa(port)}, &slice)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slice.Labels[discoveryv1.LabelServiceName] != svc || len(slice.OwnerReferences) != 1 || slice.OwnerReferences[0].Name != svc {
+		t.Errorf("slice %s is not labelled and owned for Service %s", slice.Name, svc)
+	}
+	if len(slice.Ports) != 1 || *slice.Ports[0].Port != port {
+		t.Errorf("slice %s has ports %v, want %d", slice.Name, slice.Ports, port)
+	}
+	addrs := []string{}
+	for _, ep := range slice.Endpoints {
+		addrs = append(addrs, ep.Addresses...)
+	}
+	return addrs
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	a, _, _ := reg.Register(registry.Service{Name: "billing", Address: "http://192.168.1.11:8083"})
+	a2, _, _ := reg.Register(registry.Service{Name: "billing", Address: "http://192.168.1.10:8083"})
+	b, _, _ := reg.Register(registry.Service{Name: "billing", Address: "http://192.168.1.12:9000"})
+	// Not exported: services running in the cluster, imported ones, names
+	// that cannot be Services and a Service that is not ours.
+	reg.Register(registry.Service{Name: "orders", Address: "http://10.2.0.1:8082"})
+	reg.Register(registry.Service{Name: "products", Address: "http://10.1.0.1:8081", Tags: []string{Tag, namespaceTagPrefix + "shop"}})
+	reg.Register(registry.Service{Name: "Legacy_CRM", Address: "http://192.168.1.20:80"})
+	reg.Register(registry.Service{Name: "mail", Address: "http://192.168.1.30:25"})
+
+	mail := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "mail", Namespace: "registry"}}
+	c := newFakeClient(t, microservice("shop", "orders"), mail)
+	e := &exporter{Client: c, reg: reg, opts: Options{ExportNamespace: "registry"}}
+	if err := e.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var services corev1.ServiceList
+	if err := c.List(ctx, &services, client.InNamespace("registry"), client.MatchingLabels{managedByLabel: managedBy}); err != nil {
+		t.Fatal(err)
+	}
+	if len(services.Items) != 1 || services.Items[0].Name != "billing" {
+		t.Fatalf("exported %v, want only billing", services.Items)
+	}
+	if svc := services.Items[0]; svc.Spec.Selector != nil || svc.Spec.Ports[0].Port != exportPort {
+		t.Errorf("billing Service has selector %v and ports %v, want a selectorless Service on port %d", svc.Spec.Selector, svc.Spec.Ports, exportPort)
+	}
+	if got := exported(t, c, "billing", 8083); !slices.Equal(got, []string{"192.168.1.10", "192.168.1.11"}) {
+		t.Errorf("billing port 8083 exports %v", got)
+	}
+	if got := exported(t, c, "billing", 9000); !slices.Equal(got, []string{"192.168.1.12"}) {
+		t.Errorf("billing port 9000 exports %v", got)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(mail), mail); err != nil || mail.Labels[managedByLabel] != "" {
+		t.Errorf("the existing mail Service was taken over: %v, labels %v", err, mail.Labels)
+	}
+
+	// Instances that leave are removed, and so are their slices.
+	reg.Deregister("billing", b.ID)
+	if err := e.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := exported(t, c, "billing", 9000); got != nil {
+		t.Errorf("the slice of a port without instances still exports %v", got)
+	}
+	if got := exported(t, c, "billing", 8083); len(got) != 2 {
+		t.Errorf("billing port 8083 exports %v after another port left", got)
+	}
+
+	// The Service goes with the last instance.
+	reg.Deregister("billing", a.ID)
+	reg.Deregister("billing", a2.ID)
+	if err := e.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	billing := &corev1.Service{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "registry", Name: "billing"}, billing); !apierrors.IsNotFound(err) {
+		t.Errorf("the billing Service outlived its instances: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package kubesync
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// importer mirrors the endpoints of one Service into the registry per
+// reconcile. Only Services owned by a Microservice are imported.
+type importer struct {
+	client.Client
+	reg  *registry.Registry
+	opts Options
+}
+
+func setupImport(mgr manager.Manager, reg *registry.Registry, opts Options) error {
+	inScope := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return opts.Namespace == "" || obj.GetNamespace() == opts.Namespace
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("registry-import").
+		For(&corev1.Service{}, builder.WithPredicates(inScope, predicate.NewPredicateFuncs(ownedByMicroservice))).
+		Watches(&discoveryv1.EndpointSlice{}, handler.EnqueueRequestsFromMapFunc(sliceService), builder.WithPredicates(inScope)).
+		Complete(&importer{Client: mgr.GetClient(), reg: reg, opts: opts})
+}
+
+func ownedByMicroservice(obj client.Object) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == "Microservice" && strings.HasPrefix(ref.APIVersion, microserviceGroup+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sliceService maps an EndpointSlice to the Service it belongs to.
+func sliceService(ctx context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[discoveryv1.LabelServiceName]
+	if name == "" || obj.GetLabels()[managedByLabel] == managedBy {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+func (im *importer) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger := log.FromContext(ctx)
+	if !im.reg.IsLeader() {
+		return reconcile.Result{RequeueAfter: notLeaderRetry}, nil
+	}
+
+	desired := map[string]registry.Service{}
+	var svc corev1.Service
+	err := im.Get(ctx, req.NamespacedName, &svc)
+	switch {
+	case apierrors.IsNotFound(err):
+		// Deleted: every instance imported for it goes away below.
+	case err != nil:
+		return reconcile.Result{}, err
+	case ownedByMicroservice(&svc) && svc.DeletionTimestamp == nil:
+		var slices discoveryv1.EndpointSliceList
+		err := im.List(ctx, &slices, client.InNamespace(req.Namespace), client.MatchingLabels{discoveryv1.LabelServiceName: req.Name})
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		for _, slice := range slices.Items {
+			for _, inst := range sliceInstances(&svc, &slice) {
+				desired[inst.ID] = inst
+			}
+		}
+	}
+
+	existing, _ := im.reg.Instances(req.Name)
+	known := map[string]bool{}
+	for _, inst := range existing {
+		known[inst.ID] = true
+		if _, keep := desired[inst.ID]; keep || !imported(inst, req.Namespace) {
+			continue
+		}
+		if err := im.reg.Deregister(inst.Name, inst.ID); err != nil && !errors.Is(err, registry.ErrNotFound) {
+			return reconcile.Result{}, err
+		}
+		logger.Info("Removed instance from registry", "service", inst.Name, "address", inst.Address)
+	}
+	for id, inst := range desired {
+		// An instance that registered itself under the same ID is left alone.
+		if known[id] {
+			continue
+		}
+		if _, _, err := im.reg.Register(inst); err != nil {
+			return reconcile.Result{}, err
+		}
+		logger.Info("Added instance to registry", "service", inst.Name, "address", inst.Address)
+	}
+	// Periodically re-add instances a registry restart may have lost.
+	return reconcile.Result{RequeueAfter: im.opts.Resync}, nil
+}
+
+// sliceInstances turns the ready endpoints of slice into registry instances
+// named after svc.
+func sliceInstances(svc *corev1.Service, slice *discoveryv1.EndpointSlice) []registry.Service {
+	if slice.AddressType == discoveryv1.AddressTypeFQDN {
+		return nil
+	}
+	var port int32
+	for _, p := range slice.Ports {
+		if p.Port != nil && (p.Protocol == nil || *p.Protocol == corev1.ProtocolTCP) {
+			port = *p.Port
+			break
+		}
+	}
+	if port == 0 {
+		return nil
+	}
+
+	var out []registry.Service
+	for _, ep := range slice.Endpoints {
+		if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+			continue
+		}
+		if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+			continue
+		}
+		for _, ip := range ep.Addresses {
+			inst := registry.Service{
+				Name:    svc.Name,
+				Address: "http://" + net.JoinHostPort(ip, itoa(port)),
+				Tags:    []string{Tag, namespaceTagPrefix + svc.Namespace},
+			}
+			if ep.Zone != nil {
+				inst.Zone = *ep.Zone
+			}
+			// Same ID as the pod's own registration, so the two never duplicate.
+			inst.ID = registry.InstanceID(inst.Name, inst.Address)
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// imported reports whether inst was added by the importer for namespace.
+func imported(inst registry.Service, namespace string) bool {
+	return slices.Contains(inst.Tags, Tag) && slices.Contains(inst.Tags, namespaceTagPrefix+namespace)
+}
@@ -0,0 +1,196 @@
+package kubesync
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newTestRegistry(t *testing.T) *registry.Registry {
+	t.Helper()
+	reg, err := registry.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reg.Close() })
+	return reg
+}
+
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+// microservice returns the Service the operator creates for a Microservice.
+func microservice(namespace, name string) *corev1.Service {
+	return &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: microserviceGroup + "/v1alpha1",
+			Kind:       "Microservice",
+			Name:       name,
+			UID:        types.UID(name),
+		}},
+	}}
+}
+
+func ref[T any](v T) *T { return &v }
+
+type endpoint struct {
+	ip          string
+	ready       bool
+	terminating bool
+	zone        string
+}
+
+// endpointSlice returns a slice of the Service name with a TCP port.
+func endpointSlice(namespace, name string, port int32, endpoints ...endpoint) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-abcde",
+			Namespace: namespace,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: name},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: ref("http"), Protocol: ref(corev1.ProtocolTCP), Port: ref(port)}},
+	}
+	for _, ep := range endpoints {
+		e := discoveryv1.Endpoint{
+			Addresses:  []string{ep.ip},
+			Conditions: discoveryv1.EndpointConditions{Ready: ref(ep.ready), Terminating: ref(ep.terminating)},
+		}
+		if ep.zone != "" {
+			e.Zone = ref(ep.zone)
+		}
+		slice.Endpoints = append(slice.Endpoints, e)
+	}
+	return slice
+}
+
+// addresses returns the sorted addresses of the instances of name.
+func addresses(reg *registry.Registry, name string) []string {
+	instances, _ := reg.Instances(name)
+	var out []string
+	for _, inst := range instances {
+		out = append(out, inst.Address)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	// Neither the pod that registered itself nor an import from another
+	// namespace belongs to this Service's import.
+	reg.Register(registry.Service{Name: "orders", Address: "http://10.2.0.1:8082"})
+	reg.Register(registry.Service{Name: "orders", Address: "http://10.3.0.1:8082", Tags: []string{Tag, namespaceTagPrefix + "staging"}})
+
+	slice := endpointSlice("shop", "orders", 8082,
+		endpoint{ip: "10.1.0.1", ready: true},
+		endpoint{ip: "10.1.0.2", ready: true, zone: "eu-west-1a"},
+		endpoint{ip: "10.1.0.3", ready: false},
+		endpoint{ip: "10.1.0.4", ready: true, terminating: true},
+	)
+	c := newFakeClient(t, microservice("shop", "orders"), slice)
+	im := &importer{Client: c, reg: reg, opts: Options{Resync: 1}}
+	reconcileOrders := func() {
+		t.Helper()
+		if _, err := im.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "shop", Name: "orders"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	others := []string{"http://10.2.0.1:8082", "http://10.3.0.1:8082"}
+	want := func(imported ...string) []string {
+		out := append(slices.Clone(others), imported...)
+		slices.Sort(out)
+		return out
+	}
+
+	// Ready endpoints are added, with the namespace tag and zone.
+	reconcileOrders()
+	if got := addresses(reg, "orders"); !slices.Equal(got, want("http://10.1.0.1:8082", "http://10.1.0.2:8082")) {
+		t.Fatalf("after the first reconcile the registry has %v", got)
+	}
+	id := registry.InstanceID("orders", "http://10.1.0.2:8082")
+	instances, _ := reg.Instances("orders")
+	i := slices.IndexFunc(instances, func(s registry.Service) bool { return s.ID == id })
+	if i < 0 || !imported(instances[i], "shop") || instances[i].Zone != "eu-west-1a" {
+		t.Errorf("imported instance %+v, want the import tags and zone eu-west-1a", instances)
+	}
+
+	// Endpoints that leave the slice are deregistered, new ones added.
+	slice.Endpoints = slice.Endpoints[1:2]
+	slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{Addresses: []string{"10.1.0.5"}})
+	if err := c.Update(ctx, slice); err != nil {
+		t.Fatal(err)
+	}
+	reconcileOrders()
+	if got := addresses(reg, "orders"); !slices.Equal(got, want("http://10.1.0.2:8082", "http://10.1.0.5:8082")) {
+		t.Fatalf("after the slice changed the registry has %v", got)
+	}
+
+	// Deleting the Service removes only what was imported for it.
+	if err := c.Delete(ctx, microservice("shop", "orders")); err != nil {
+		t.Fatal(err)
+	}
+	reconcileOrders()
+	if got := addresses(reg, "orders"); !slices.Equal(got, want()) {
+		t.Errorf("after the Service was deleted the registry has %v, want %v", got, want())
+	}
+}
+
+func TestImportSkipsServicesWithoutMicroservice(t *testing.T) {
+	reg := newTestRegistry(t)
+	svc := microservice("shop", "orders")
+	svc.OwnerReferences = nil
+	c := newFakeClient(t, svc, endpointSlice("shop", "orders", 8082, endpoint{ip: "10.1.0.1", ready: true}))
+	im := &importer{Client: c, reg: reg, opts: Options{Resync: 1}}
+	if _, err := im.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "shop", Name: "orders"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := addresses(reg, "orders"); len(got) != 0 {
+		t.Errorf("a Service without a Microservice owner was imported: %v", got)
+	}
+}
+
+func TestImportKeepsSelfRegisteredInstance(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistry(t)
+	// The pod registered itself under the ID its endpoint would get.
+	reg.Register(registry.Service{Name: "orders", Address: "http://10.1.0.1:8082", Tags: []string{"v2"}})
+	slice := endpointSlice("shop", "orders", 8082, endpoint{ip: "10.1.0.1", ready: true})
+	c := newFakeClient(t, microservice("shop", "orders"), slice)
+	im := &importer{Client: c, reg: reg, opts: Options{Resync: 1}}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "shop", Name: "orders"}}
+
+	for _, endpoints := range [][]discoveryv1.Endpoint{slice.Endpoints, nil} {
+		slice.Endpoints = endpoints
+		if err := c.Update(ctx, slice); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := im.Reconcile(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		instances, _ := reg.Instances("orders")
+		if len(instances) != 1 || !slices.Equal(instances[0].Tags, []string{"v2"}) {
+			t.Fatalf("with %d endpoints the registry has %+v, want the pod's own registration", len(endpoints), instances)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package kubesync shares one view of service instances between the service
+// registry and Kubernetes. It mirrors the ready endpoints of Services created
+// for Microservice resources into the registry and can export services that
+// only exist in the registry, e.g. ones running on VMs, as selectorless
+// Services so that in-cluster clients reach them by their usual DNS names.
+package kubesync
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/api/v1alpha1"
+	"github.com/moodykhalif23/scalebit/internal/pkg/registry"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+const (
+	// Tag marks the registry instances that mirror Kubernetes endpoints.
+	Tag = "kubernetes"
+	// namespaceTagPrefix + namespace is the second tag of those instances.
+	namespaceTagPrefix = "namespace="
+
+	managedByLabel = "endpointslice.kubernetes.io/managed-by"
+	managedBy      = "registry.scalebit.moodykhalif23.github.com"
+
+	// notLeaderRetry is how often a follower of a replicated registry checks
+	// whether it has become the leader.
+	notLeaderRetry = 10 * time.Second
+)
+
+// Options configures the synchronisation.
+type Options struct {
+	// Namespace limits importing to one namespace; all namespaces if empty.
+	Namespace string
+	// ExportNamespace enables exporting registry-only services into it.
+	ExportNamespace string
+	// Resync is how often everything is reconciled even without changes;
+	// one minute if zero.
+	Resync time.Duration
+}
+
+// Run synchronises reg with the cluster at cfg until ctx is done. With a
+// replicated registry it runs on every node, but only the leader writes.
+func Run(ctx context.Context, cfg *rest.Config, reg *registry.Registry, opts Options) error {
+	if opts.Resync == 0 {
+		opts.Resync = time.Minute
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	mgrOpts := ctrl.Options{
+		Scheme: scheme,
+		// The registry serves its own metrics.
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	}
+	if opts.Namespace != "" {
+		namespaces := map[string]cache.Config{opts.Namespace: {}}
+		if opts.ExportNamespace != "" {
+			namespaces[opts.ExportNamespace] = cache.Config{}
+		}
+		mgrOpts.Cache = cache.Options{DefaultNamespaces: namespaces}
+	}
+	mgr, err := ctrl.NewManager(cfg, mgrOpts)
+	if err != nil {
+		return fmt.Errorf("kubesync: create manager: %w", err)
+	}
+	if err := setupImport(mgr, reg, opts); err != nil {
+		return err
+	}
+	if opts.ExportNamespace != "" {
+		if err := mgr.Add(&exporter{Client: mgr.GetClient(), reg: reg, opts: opts}); err != nil {
+			return err
+		}
+	}
+	return mgr.Start(ctx)
+}
+
+// microserviceGroup is the API group of the Microservice owner references.
+var microserviceGroup = v1alpha1.SchemeGroupVersion.Group
+
+// splitAddress returns the host and port of a registry address such as
+// "http://10.0.0.7:8082", defaulting the port from the scheme.
+func splitAddress(address string) (string, int32, bool) {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		// host:port without a scheme
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return "", 0, false
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		return host, int32(p), err == nil
+	}
+	port := u.Port()
+	switch {
+	case port != "":
+	case u.Scheme == "https":
+		port = "443"
+	default:
+		port = "80"
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	return u.Hostname(), int32(p), err == nil
+}
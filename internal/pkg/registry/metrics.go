@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countInstancesLocked sets the instance gauges of one service. Every node
+// applies the same changes, so followers report the same counts as the
+// leader. r.mu must be held.
+func (r *Registry) countInstancesLocked(name string) {
+	instances, ok := r.services[name]
+	if !ok {
+		telemetry.RegistryInstances.DeletePartialMatch(prometheus.Labels{"service": name})
+		return
+	}
+	counts := map[string]int{StatusUp: 0, StatusDown: 0}
+	for _, s := range instances {
+		counts[s.Status]++
+	}
+	for status, n := range counts {
+		telemetry.RegistryInstances.WithLabelValues(name, status).Set(float64(n))
+	}
+}
+
+// countAllLocked resets the instance gauges after the whole state was
+// replaced. r.mu must be held.
+func (r *Registry) countAllLocked() {
+	telemetry.RegistryInstances.Reset()
+	for name := range r.services {
+		r.countInstancesLocked(name)
+	}
+}
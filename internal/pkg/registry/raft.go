@@ -0,0 +1,288 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+// applyTimeout bounds how long a write waits to be committed by a quorum.
+const applyTimeout = 10 * time.Second
+
+// RaftConfig replicates a registry across several nodes with Raft. Writes
+// are accepted by the leader only; the other nodes serve reads and watches
+// from their replica and answer writes with NotLeaderError. Health checks
+// and eviction run on the leader; evictions and the status changes health
+// checks decide are replicated like any other change.
+type RaftConfig struct {
+	// ID identifies this node and must appear in Peers.
+	ID string
+	// BindAddr is the local address for Raft traffic; the node's RaftAddr in
+	// Peers if empty.
+	BindAddr string
+	// DataDir holds the Raft log and snapshots.
+	DataDir string
+	// Bootstrap forms a new cluster from Peers on first start. Set it on
+	// every node of a fresh cluster; it is ignored once state exists.
+	Bootstrap bool
+	// Peers lists every node of the cluster, including this one.
+	Peers []Peer
+}
+
+// Peer is one registry node.
+type Peer struct {
+	ID       string
+	RaftAddr string
+	// APIURL is the node's HTTP API, where followers redirect writes.
+	APIURL string
+}
+
+// ParsePeers parses a comma-separated list of id=raftAddr=apiURL entries.
+func ParsePeers(s string) ([]Peer, error) {
+	var peers []Peer
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid peer %q, want id=raftAddr=apiURL", entry)
+		}
+		peers = append(peers, Peer{ID: parts[0], RaftAddr: parts[1], APIURL: strings.TrimSuffix(parts[2], "/")})
+	}
+	return peers, nil
+}
+
+// NotLeaderError is returned for writes sent to a follower. LeaderURL is
+// empty while no leader is known, e.g. during an election.
+type NotLeaderError struct {
+	LeaderURL string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.LeaderURL == "" {
+		return "registry: no leader elected"
+	}
+	return "registry: not the leader; leader is " + e.LeaderURL
+}
+
+type raftNode struct {
+	raft  *raft.Raft
+	logs  *raftboltdb.BoltStore
+	peers map[raft.ServerID]Peer
+}
+
+func startRaft(r *Registry, cfg RaftConfig) (*raftNode, error) {
+	peers := make(map[raft.ServerID]Peer, len(cfg.Peers))
+	var servers []raft.Server
+	for _, p := range cfg.Peers {
+		peers[raft.ServerID(p.ID)] = p
+		servers = append(servers, raft.Server{ID: raft.ServerID(p.ID), Address: raft.ServerAddress(p.RaftAddr)})
+	}
+	self, ok := peers[raft.ServerID(cfg.ID)]
+	if !ok {
+		return nil, fmt.Errorf("raft: node %q is not in the peer list", cfg.ID)
+	}
+	bind := cfg.BindAddr
+	if bind == "" {
+		bind = self.RaftAddr
+	}
+	advertise, err := net.ResolveTCPAddr("tcp", self.RaftAddr)
+	if err != nil {
+		return nil, fmt.Errorf("raft: resolve %s: %w", self.RaftAddr, err)
+	}
+
+	if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
+		return nil, err
+	}
+	logs, err := raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft.db"))
+	if err != nil {
+		return nil, fmt.Errorf("raft: open log: %w", err)
+	}
+	snapshots, err := raft.NewFileSnapshotStore(cfg.DataDir, 2, os.Stderr)
+	if err != nil {
+		logs.Close()
+		return nil, fmt.Errorf("raft: open snapshots: %w", err)
+	}
+	transport, err := raft.NewTCPTransport(bind, advertise, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		logs.Close()
+		return nil, fmt.Errorf("raft: listen on %s: %w", bind, err)
+	}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.ID)
+	conf.LogLevel = "WARN"
+
+	if cfg.Bootstrap {
+		existing, err := raft.HasExistingState(logs, logs, snapshots)
+		if err != nil {
+			transport.Close()
+			logs.Close()
+			return nil, err
+		}
+		if !existing {
+			err := raft.BootstrapCluster(conf, logs, logs, snapshots, transport, raft.Configuration{Servers: servers})
+			if err != nil {
+				transport.Close()
+				logs.Close()
+				return nil, fmt.Errorf("raft: bootstrap: %w", err)
+			}
+		}
+	}
+
+	rf, err := raft.NewRaft(conf, (*registryFSM)(r), logs, logs, snapshots, transport)
+	if err != nil {
+		transport.Close()
+		logs.Close()
+		return nil, fmt.Errorf("raft: start: %w", err)
+	}
+	return &raftNode{raft: rf, logs: logs, peers: peers}, nil
+}
+
+func (n *raftNode) apply(o op) (bool, error) {
+	if n.raft.State() != raft.Leader {
+		return false, n.notLeader()
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return false, err
+	}
+	f := n.raft.Apply(data, applyTimeout)
+	if err := f.Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return false, n.notLeader()
+		}
+		return false, err
+	}
+	res := f.Response().(applyResponse)
+	return res.created, res.err
+}
+
+func (n *raftNode) notLeader() error {
+	_, id := n.raft.LeaderWithID()
+	return &NotLeaderError{LeaderURL: n.peers[id].APIURL}
+}
+
+func (n *raftNode) shutdown() error {
+	err := n.raft.Shutdown().Error()
+	if cerr := n.logs.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// IsLeader reports whether this node accepts writes. It is always true for
+// a registry that is not replicated.
+func (r *Registry) IsLeader() bool {
+	return r.raft == nil || r.raft.raft.State() == raft.Leader
+}
+
+// ClusterStatus describes a replicated registry as seen from one node.
+type ClusterStatus struct {
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	LeaderID  string `json:"leaderId"`
+	LeaderURL string `json:"leaderUrl"`
+	Peers     []Peer `json:"peers"`
+}
+
+// Cluster returns the replication status, or nil for a single-node registry.
+func (r *Registry) Cluster() *ClusterStatus {
+	if r.raft == nil {
+		return nil
+	}
+	_, leader := r.raft.raft.LeaderWithID()
+	return &ClusterStatus{
+		ID:        r.raftConfig.ID,
+		State:     r.raft.raft.State().String(),
+		LeaderID:  string(leader),
+		LeaderURL: r.raft.peers[leader].APIURL,
+		Peers:     r.raftConfig.Peers,
+	}
+}
+
+// registryFSM applies the replicated log to a Registry.
+type registryFSM Registry
+
+type applyResponse struct {
+	created bool
+	err     error
+}
+
+func (f *registryFSM) Apply(l *raft.Log) interface{} {
+	var o op
+	if err := json.Unmarshal(l.Data, &o); err != nil {
+		return applyResponse{err: fmt.Errorf("decode op: %w", err)}
+	}
+	created, err := (*Registry)(f).apply(o)
+	return applyResponse{created: created, err: err}
+}
+
+func (f *registryFSM) Snapshot() (raft.FSMSnapshot, error) {
+	services, _ := (*Registry)(f).Snapshot()
+	var all []Service
+	for _, instances := range services {
+		for _, s := range instances {
+			all = append(all, s.replicated())
+		}
+	}
+	return fsmSnapshot(all), nil
+}
+
+// Restore replaces the whole state, including the store, with a snapshot.
+// Watchers cannot follow the change event by event and resynchronise.
+func (f *registryFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var all []Service
+	if err := json.NewDecoder(rc).Decode(&all); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	r := (*Registry)(f)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, instances := range r.services {
+		for _, s := range instances {
+			if err := r.store.Delete(s.Name, s.ID); err != nil {
+				return err
+			}
+		}
+	}
+	r.services = make(map[string][]Service)
+	for _, s := range all {
+		if err := r.store.Put(s); err != nil {
+			return err
+		}
+		r.services[s.Name] = append(r.services[s.Name], s)
+	}
+	r.countAllLocked()
+	r.index++
+	r.events = nil
+	close(r.changed)
+	r.changed = make(chan struct{})
+	return nil
+}
+
+type fsmSnapshot []Service
+
+func (s fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode([]Service(s)); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s fsmSnapshot) Release() {}
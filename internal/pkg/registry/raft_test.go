@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a loopback address nothing listens on right now.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// startCluster starts n replicated registries in this process, each with a
+// bbolt store, and returns them by node ID.
+func startCluster(t *testing.T, n int, opts ...Option) map[string]*Registry {
+	t.Helper()
+	var peers []Peer
+	for i := 0; i < n; i++ {
+		peers = append(peers, Peer{ID: fmt.Sprintf("node%d", i), RaftAddr: freeAddr(t), APIURL: fmt.Sprintf("http://node%d", i)})
+	}
+	nodes := map[string]*Registry{}
+	for _, p := range peers {
+		dir := t.TempDir()
+		store, err := OpenBoltStore(filepath.Join(dir, "registry.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := New(append([]Option{
+			WithStore(store),
+			WithRaft(RaftConfig{ID: p.ID, DataDir: dir, Bootstrap: true, Peers: peers}),
+		}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[p.ID] = r
+	}
+	t.Cleanup(func() {
+		for _, r := range nodes {
+			r.Close()
+		}
+	})
+	return nodes
+}
+
+// waitForLeader returns the ID of the leader among nodes.
+func waitForLeader(t *testing.T, nodes map[string]*Registry) string {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		for id, r := range nodes {
+			if r.IsLeader() {
+				return id
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("no leader elected")
+	return ""
+}
+
+// waitForInstances waits until r holds want instances of name.
+func waitForInstances(t *testing.T, r *Registry, name string, want int) []Service {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		instances, _ := r.Instances(name)
+		if len(instances) == want || time.Now().After(deadline) {
+			if len(instances) != want {
+				t.Fatalf("%s has %d instances, want %d", name, len(instances), want)
+			}
+			return instances
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRaftFailover(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a three-node Raft cluster")
+	}
+	nodes := startCluster(t, 3)
+	leader := waitForLeader(t, nodes)
+
+	first, _, err := nodes[leader].Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, r := range nodes {
+		if id == leader {
+			continue
+		}
+		waitForInstances(t, r, "orders", 1)
+		var notLeader *NotLeaderError
+		_, _, err := r.Register(Service{Name: "orders", Address: "http://10.0.0.9:8082"})
+		if !errors.As(err, &notLeader) || notLeader.LeaderURL != "http://"+leader {
+			t.Errorf("write to follower %s: %v, want NotLeaderError pointing at %s", id, err, leader)
+		}
+	}
+
+	nodes[leader].Close()
+	delete(nodes, leader)
+	next := waitForLeader(t, nodes)
+
+	if _, _, err := nodes[next].Register(Service{Name: "orders", Address: "http://10.0.0.2:8082"}); err != nil {
+		t.Fatalf("write to the new leader: %v", err)
+	}
+	for _, r := range nodes {
+		instances := waitForInstances(t, r, "orders", 2)
+		if instances[0].ID != first.ID {
+			t.Errorf("instances after failover: %+v", instances)
+		}
+	}
+}
+
+func TestHealthChecksOnlyReplicateStatusChanges(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a Raft node")
+	}
+	var healthy atomic.Bool
+	healthy.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	nodes := startCluster(t, 1, WithThresholds(1, 1))
+	r := nodes[waitForLeader(t, nodes)]
+	inst, _, err := r.Register(Service{Name: "orders", Address: backend.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	before := r.raft.raft.LastIndex()
+	for i := 0; i < 3; i++ {
+		r.CheckHealth(ctx)
+	}
+	if got := r.raft.raft.LastIndex(); got != before {
+		t.Errorf("passing checks of an UP instance appended %d log entries", got-before)
+	}
+	if s, _ := r.instance("orders", inst.ID); s.ConsecutiveSuccesses != 3 || s.LastCheck == nil {
+		t.Errorf("bookkeeping after three passing checks: %+v", s)
+	}
+
+	healthy.Store(false)
+	r.CheckHealth(ctx)
+	r.CheckHealth(ctx)
+	if got := r.raft.raft.LastIndex(); got != before+1 {
+		t.Errorf("going DOWN appended %d log entries, want 1", got-before)
+	}
+	s, _ := r.instance("orders", inst.ID)
+	if s.Status != StatusDown || s.ConsecutiveFailures != 2 {
+		t.Errorf("after two failing checks: %+v", s)
+	}
+	stored, _ := r.store.Load()
+	if len(stored) != 1 || stored[0].Status != StatusDown || stored[0].LastCheck != nil {
+		t.Errorf("stored instance %+v, want DOWN without bookkeeping", stored)
+	}
+}
@@ -0,0 +1,543 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
+)
+
+const (
+	StatusUp   = "UP"
+	StatusDown = "DOWN"
+)
+
+var (
+	ErrNotFound = errors.New("registry: instance not found")
+	ErrInvalid  = errors.New("registry: invalid registration")
+)
+
+// Service is one registered instance of a service.
+type Service struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Status  string `json:"status"` // "UP", "DOWN"
+
+	Version string   `json:"version,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Zone    string   `json:"zone,omitempty"`
+	// Weight is the relative share of traffic for load balancers; 1 if unset.
+	Weight int `json:"weight"`
+
+	// Check configures how the instance is health checked; nil means an
+	// HTTP GET of <address>/health.
+	Check *HealthCheck `json:"check,omitempty"`
+	// Health check bookkeeping, maintained by the node running the checks.
+	// It is neither stored nor replicated; only Status changes are.
+	LastCheck            *time.Time `json:"lastCheck,omitempty"`
+	LastError            string     `json:"lastError,omitempty"`
+	ConsecutiveFailures  int        `json:"consecutiveFailures,omitempty"`
+	ConsecutiveSuccesses int        `json:"consecutiveSuccesses,omitempty"`
+
+	// TTL is how long the instance stays registered without a heartbeat.
+	// Zero means it never expires.
+	TTL           Duration   `json:"ttl,omitempty"`
+	RegisteredAt  time.Time  `json:"registeredAt"`
+	LastHeartbeat time.Time  `json:"lastHeartbeat"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Duration is a time.Duration that reads and writes JSON as a string such
+// as "30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// InstanceID derives the ID used when an instance registers without one, so
+// re-registering the same address is idempotent.
+func InstanceID(name, address string) string {
+	sum := sha256.Sum256([]byte(address))
+	return name + "-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// Option configures a Registry.
+type Option func(*Registry)
+
+// WithHealthInterval sets how often instances are health checked.
+func WithHealthInterval(d time.Duration) Option {
+	return func(r *Registry) { r.healthInterval = d }
+}
+
+// WithHealthTimeout bounds each individual health check.
+func WithHealthTimeout(d time.Duration) Option {
+	return func(r *Registry) { r.healthTimeout = d }
+}
+
+// WithHTTPClient sets the client used for health checks. Its Timeout is
+// replaced by the health timeout.
+func WithHTTPClient(c *http.Client) Option {
+	return func(r *Registry) { r.httpClient = c }
+}
+
+// WithHealthWorkers sets how many health checks run concurrently.
+func WithHealthWorkers(n int) Option {
+	return func(r *Registry) { r.healthWorkers = n }
+}
+
+// WithThresholds sets how many consecutive failed checks mark an UP instance
+// DOWN, and how many consecutive successful ones bring it back UP.
+func WithThresholds(failures, successes int) Option {
+	return func(r *Registry) {
+		r.failureThreshold = failures
+		r.successThreshold = successes
+	}
+}
+
+// WithChecker registers the Checker used for instances whose health check
+// protocol is protocol, replacing the built-in one if any.
+func WithChecker(protocol string, c Checker) Option {
+	return func(r *Registry) { r.checkers[protocol] = c }
+}
+
+// WithDefaultTTL applies to instances that register without a TTL. Zero (the
+// default) keeps them until they deregister.
+func WithDefaultTTL(d time.Duration) Option {
+	return func(r *Registry) { r.defaultTTL = d }
+}
+
+// WithEvictionInterval sets how often expired instances are removed.
+func WithEvictionInterval(d time.Duration) Option {
+	return func(r *Registry) { r.evictionInterval = d }
+}
+
+// WithStore persists instances in st instead of memory only. The registry
+// takes ownership of st and closes it in Close.
+func WithStore(st Store) Option {
+	return func(r *Registry) { r.store = st }
+}
+
+// WithRaft replicates the registry across the nodes of cfg.Peers; see
+// RaftConfig.
+func WithRaft(cfg RaftConfig) Option {
+	return func(r *Registry) { r.raftConfig = &cfg }
+}
+
+// Registry keeps the known instances of every service and their health.
+type Registry struct {
+	mu       sync.RWMutex
+	services map[string][]Service
+	// writeMu serialises read-modify-commit sequences so that two writers
+	// never compute a new instance from the same old one.
+	writeMu sync.Mutex
+
+	healthInterval   time.Duration
+	healthTimeout    time.Duration
+	healthWorkers    int
+	failureThreshold int
+	successThreshold int
+	httpClient       *http.Client
+	checkers         map[string]Checker
+	defaultTTL       time.Duration
+	evictionInterval time.Duration
+	now              func() time.Time
+
+	policy     Policy
+	store      Store
+	raftConfig *RaftConfig
+	raft       *raftNode
+
+	// Change feed for watchers; see watch.go.
+	index   uint64
+	events  []Event
+	changed chan struct{}
+}
+
+// New creates a Registry holding the instances found in its store. Health
+// checks and eviction only run once Run is called.
+func New(opts ...Option) (*Registry, error) {
+	r := &Registry{
+		services:         make(map[string][]Service),
+		healthInterval:   30 * time.Second,
+		healthTimeout:    5 * time.Second,
+		healthWorkers:    8,
+		failureThreshold: 3,
+		successThreshold: 1,
+		httpClient:       &http.Client{},
+		checkers:         map[string]Checker{},
+		evictionInterval: 5 * time.Second,
+		now:              time.Now,
+		store:            NewMemoryStore(),
+		changed:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	hc := *r.httpClient
+	hc.Timeout = r.healthTimeout
+	r.httpClient = &hc
+	if _, ok := r.checkers[ProtocolHTTP]; !ok {
+		r.checkers[ProtocolHTTP] = &HTTPChecker{Client: r.httpClient}
+	}
+	if _, ok := r.checkers[ProtocolTCP]; !ok {
+		r.checkers[ProtocolTCP] = &TCPChecker{}
+	}
+	if _, ok := r.checkers[ProtocolGRPC]; !ok {
+		r.checkers[ProtocolGRPC] = &GRPCChecker{}
+	}
+	if r.healthWorkers < 1 {
+		r.healthWorkers = 1
+	}
+
+	instances, err := r.store.Load()
+	if err != nil {
+		r.store.Close()
+		return nil, fmt.Errorf("load registry store: %w", err)
+	}
+	for _, s := range instances {
+		r.services[s.Name] = append(r.services[s.Name], s)
+	}
+	r.countAllLocked()
+	if r.raftConfig != nil {
+		if r.raft, err = startRaft(r, *r.raftConfig); err != nil {
+			r.store.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Close stops replication and closes the store.
+func (r *Registry) Close() error {
+	if r.raft != nil {
+		if err := r.raft.shutdown(); err != nil {
+			r.store.Close()
+			return err
+		}
+	}
+	return r.store.Close()
+}
+
+// Register adds or updates an instance. An instance without an ID gets one
+// from InstanceID, and registering an existing ID replaces its address and
+// metadata and renews its TTL instead of adding a duplicate. It returns the
+// stored instance and whether it was newly created.
+func (r *Registry) Register(s Service) (Service, bool, error) {
+	if s.Name == "" || s.Address == "" {
+		return Service{}, false, fmt.Errorf("%w: name and address are required", ErrInvalid)
+	}
+	if s.Check != nil && s.Check.Protocol != "" {
+		if _, ok := r.checkers[s.Check.Protocol]; !ok {
+			return Service{}, false, fmt.Errorf("%w: unknown health check protocol %q", ErrInvalid, s.Check.Protocol)
+		}
+	}
+	if s.ID == "" {
+		s.ID = InstanceID(s.Name, s.Address)
+	}
+	if s.Weight <= 0 {
+		s.Weight = 1
+	}
+	if s.TTL == 0 {
+		s.TTL = Duration(r.defaultTTL)
+	}
+	now := r.now()
+	s.Status = StatusUp
+	s.RegisteredAt = now
+	s.LastHeartbeat = now
+	s.ExpiresAt = expiry(s.TTL, now)
+	s.LastCheck, s.LastError = nil, ""
+	s.ConsecutiveFailures, s.ConsecutiveSuccesses = 0, 0
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	if old, ok := r.instance(s.Name, s.ID); ok {
+		s.RegisteredAt = old.RegisteredAt
+		if old.Address == s.Address {
+			// Same endpoint: keep what health checks established.
+			s.Status = old.Status
+			s.LastCheck, s.LastError = old.LastCheck, old.LastError
+			s.ConsecutiveFailures = old.ConsecutiveFailures
+			s.ConsecutiveSuccesses = old.ConsecutiveSuccesses
+		}
+	}
+	created, err := r.commit(op{Type: opPut, Service: s})
+	if err != nil {
+		return Service{}, false, err
+	}
+	telemetry.RegistryRegistrations.WithLabelValues(s.Name).Inc()
+	return s, created, nil
+}
+
+// Deregister removes an instance. It returns ErrNotFound if it is unknown.
+func (r *Registry) Deregister(name, id string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	s, ok := r.instance(name, id)
+	if !ok {
+		return ErrNotFound
+	}
+	if _, err := r.commit(op{Type: opDelete, Service: s}); err != nil {
+		return err
+	}
+	telemetry.RegistryDeregistrations.WithLabelValues(name, "deregister").Inc()
+	return nil
+}
+
+// Heartbeat renews the TTL of an instance. ErrNotFound tells the caller it
+// was evicted and has to register again.
+func (r *Registry) Heartbeat(name, id string) (Service, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	s, ok := r.instance(name, id)
+	if !ok {
+		return Service{}, ErrNotFound
+	}
+	now := r.now()
+	s.LastHeartbeat = now
+	s.ExpiresAt = expiry(s.TTL, now)
+	if _, err := r.commit(op{Type: opPut, Service: s}); err != nil {
+		return Service{}, err
+	}
+	return s, nil
+}
+
+// EvictExpired removes every instance whose TTL has run out and returns them.
+func (r *Registry) EvictExpired() []Service {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	now := r.now()
+	var evicted []Service
+	for _, instances := range r.Services() {
+		for _, inst := range instances {
+			if inst.ExpiresAt == nil || !now.After(*inst.ExpiresAt) {
+				continue
+			}
+			if _, err := r.commit(op{Type: opDelete, Service: inst}); err != nil {
+				log.Printf("Evicting %s/%s: %v", inst.Name, inst.ID, err)
+				continue
+			}
+			telemetry.RegistryDeregistrations.WithLabelValues(inst.Name, "expired").Inc()
+			evicted = append(evicted, inst)
+		}
+	}
+	return evicted
+}
+
+// instance returns a copy of one instance.
+func (r *Registry) instance(name, id string) (Service, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.services[name] {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// op is one change to the registry state. Every change goes through commit
+// as an op, so that with Raft the same ops are applied on every node.
+type op struct {
+	Type    string  `json:"type"`
+	Service Service `json:"service"`
+}
+
+// commit applies o, through the Raft log when the registry is replicated.
+// It reports whether a put created a new instance.
+func (r *Registry) commit(o op) (bool, error) {
+	o.Service = o.Service.replicated()
+	if r.raft != nil {
+		return r.raft.apply(o)
+	}
+	return r.apply(o)
+}
+
+// apply writes o to the store and the in-memory state and publishes the
+// resulting event, if any.
+func (r *Registry) apply(o op) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := o.Service
+	instances := r.services[s.Name]
+	switch o.Type {
+	case opPut:
+		if err := r.store.Put(s); err != nil {
+			return false, err
+		}
+		for i := range instances {
+			if instances[i].ID == s.ID {
+				old := instances[i]
+				if old.Address == s.Address {
+					s.LastCheck, s.LastError = old.LastCheck, old.LastError
+					s.ConsecutiveFailures = old.ConsecutiveFailures
+					s.ConsecutiveSuccesses = old.ConsecutiveSuccesses
+				}
+				instances[i] = s
+				switch {
+				case !sameRegistration(old, s):
+					r.publishLocked(EventUpdated, s)
+				case old.Status != s.Status:
+					r.publishLocked(EventStatus, s)
+				}
+				r.countInstancesLocked(s.Name)
+				return false, nil
+			}
+		}
+		r.services[s.Name] = append(instances, s)
+		r.publishLocked(EventAdded, s)
+		r.countInstancesLocked(s.Name)
+		return true, nil
+	case opDelete:
+		if err := r.store.Delete(s.Name, s.ID); err != nil {
+			return false, err
+		}
+		for i := range instances {
+			if instances[i].ID == s.ID {
+				r.publishLocked(EventRemoved, instances[i])
+				r.removeLocked(s.Name, i)
+				r.countInstancesLocked(s.Name)
+				return false, nil
+			}
+		}
+		return false, ErrNotFound
+	}
+	return false, fmt.Errorf("registry: unknown op %q", o.Type)
+}
+
+// setHealth records the health check bookkeeping of s on this node only.
+func (r *Registry) setHealth(s Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instances := r.services[s.Name]
+	for i := range instances {
+		if instances[i].ID == s.ID {
+			instances[i].LastCheck, instances[i].LastError = s.LastCheck, s.LastError
+			instances[i].ConsecutiveFailures = s.ConsecutiveFailures
+			instances[i].ConsecutiveSuccesses = s.ConsecutiveSuccesses
+			return
+		}
+	}
+}
+
+// replicated returns s without the health check bookkeeping, as it is
+// stored and replicated.
+func (s Service) replicated() Service {
+	s.LastCheck, s.LastError = nil, ""
+	s.ConsecutiveFailures, s.ConsecutiveSuccesses = 0, 0
+	return s
+}
+
+func (r *Registry) removeLocked(name string, i int) {
+	instances := r.services[name]
+	instances = append(instances[:i:i], instances[i+1:]...)
+	if len(instances) == 0 {
+		delete(r.services, name)
+		return
+	}
+	r.services[name] = instances
+}
+
+func expiry(ttl Duration, now time.Time) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	t := now.Add(time.Duration(ttl))
+	return &t
+}
+
+// Services returns a copy of all registered instances keyed by service name.
+func (r *Registry) Services() map[string][]Service {
+	services, _ := r.Snapshot()
+	return services
+}
+
+// Snapshot is Services together with the index of the last change it
+// includes, for watchers that continue with EventsSince.
+func (r *Registry) Snapshot() (map[string][]Service, uint64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make(map[string][]Service, len(r.services))
+	for name, instances := range r.services {
+		out[name] = append([]Service(nil), instances...)
+	}
+	return out, r.index
+}
+
+// Instances returns a copy of the instances of name and whether the service
+// is known at all.
+func (r *Registry) Instances(name string) ([]Service, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	instances, ok := r.services[name]
+	return append([]Service(nil), instances...), ok
+}
+
+// Run health checks every instance each health interval and evicts expired
+// instances each eviction interval until ctx is done. In a replicated
+// registry only the leader does either.
+func (r *Registry) Run(ctx context.Context) {
+	go func() {
+		eviction := time.NewTicker(r.evictionInterval)
+		defer eviction.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-eviction.C:
+				if r.IsLeader() {
+					r.EvictExpired()
+				}
+			}
+		}
+	}()
+
+	health := time.NewTicker(r.healthInterval)
+	defer health.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-health.C:
+			if r.IsLeader() {
+				r.CheckHealth(ctx)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(t *testing.T, opts ...Option) *Registry {
+	t.Helper()
+	r, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func postJSON(t *testing.T, url string, v interface{}) *http.Response {
+	t.Helper()
+	body, _ := json.Marshal(v)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHandlerRegisterListDeregister(t *testing.T) {
+	r := newTestRegistry(t)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+
+	resp := postJSON(t, srv.URL+"/register", map[string]string{"service": "orders", "address": "http://10.0.0.1:8082"})
+	var inst Service
+	json.NewDecoder(resp.Body).Decode(&inst)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: got %d, want 201", resp.StatusCode)
+	}
+	if inst.ID != InstanceID("orders", "http://10.0.0.1:8082") || inst.Status != StatusUp || inst.Weight != 1 {
+		t.Errorf("registered %+v", inst)
+	}
+
+	resp, err := http.Get(srv.URL + "/services/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instances []Service
+	json.NewDecoder(resp.Body).Decode(&instances)
+	resp.Body.Close()
+	if len(instances) != 1 || instances[0].Address != "http://10.0.0.1:8082" {
+		t.Fatalf("GET /services/orders = %+v", instances)
+	}
+	if resp.Header.Get("X-Registry-Index") != "1" {
+		t.Errorf("X-Registry-Index = %q, want 1", resp.Header.Get("X-Registry-Index"))
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/services/orders/"+inst.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("deregister: got %d, want 204", resp.StatusCode)
+	}
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second deregister: got %d, want 404", resp.StatusCode)
+	}
+	resp, _ = http.Get(srv.URL + "/services/orders")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of a service without instances: got %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestRegisterValidates(t *testing.T) {
+	r := newTestRegistry(t)
+	for _, s := range []Service{
+		{Name: "orders"},
+		{Address: "http://10.0.0.1:8082"},
+		{Name: "orders", Address: "http://10.0.0.1:8082", Check: &HealthCheck{Protocol: "udp"}},
+	} {
+		if _, _, err := r.Register(s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Register(%+v) = %v, want ErrInvalid", s, err)
+		}
+	}
+}
+
+func TestRegisterIsIdempotent(t *testing.T) {
+	r := newTestRegistry(t)
+	first, created, err := r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082", Version: "1"})
+	if err != nil || !created {
+		t.Fatalf("first Register: created %v, %v", created, err)
+	}
+	second, created, err := r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082", Version: "2"})
+	if err != nil || created {
+		t.Fatalf("second Register: created %v, %v", created, err)
+	}
+	instances, _ := r.Instances("orders")
+	if len(instances) != 1 || second.ID != first.ID || instances[0].Version != "2" {
+		t.Errorf("instances after re-registering: %+v", instances)
+	}
+	if !second.RegisteredAt.Equal(first.RegisteredAt) {
+		t.Errorf("re-registering moved RegisteredAt")
+	}
+}
+
+func TestHeartbeatAndEviction(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newTestRegistry(t, WithDefaultTTL(30*time.Second))
+	r.now = func() time.Time { return now }
+
+	kept, _, _ := r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	expired, _, _ := r.Register(Service{Name: "orders", Address: "http://10.0.0.2:8082"})
+
+	now = now.Add(20 * time.Second)
+	if _, err := r.Heartbeat("orders", kept.ID); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(20 * time.Second)
+	evicted := r.EvictExpired()
+	if len(evicted) != 1 || evicted[0].ID != expired.ID {
+		t.Fatalf("evicted %+v, want only %s", evicted, expired.ID)
+	}
+	if _, ok := r.instance("orders", kept.ID); !ok {
+		t.Error("instance with a recent heartbeat was evicted")
+	}
+	if _, err := r.Heartbeat("orders", expired.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("heartbeat of an evicted instance = %v, want ErrNotFound", err)
+	}
+}
@@ -1,117 +1,314 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
-	"os/signal"
-	"sync"
-	"syscall"
+	"strconv"
 	"time"
-)
 
-type Service struct {
-	Name    string
-	Address string
-	Status  string // "UP", "DOWN"
-}
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
 
-var (
-	services = make(map[string][]Service)
-	mu       sync.RWMutex
+const (
+	// Long-poll limits for ?wait.
+	defaultWait = 5 * time.Minute
+	maxWait     = 10 * time.Minute
+	// keepAliveInterval is how often an idle /watch stream gets a comment
+	// line so proxies do not close it.
+	keepAliveInterval = 15 * time.Second
 )
 
-func RegisterService(serviceName, address string) {
-	mu.Lock()
-	defer mu.Unlock()
+// registerRequest is the body of POST /register. Only service and address
+// are required; an instance that omits id gets a stable one derived from its
+// address.
+type registerRequest struct {
+	Service string       `json:"service"`
+	ID      string       `json:"id"`
+	Address string       `json:"address"`
+	Version string       `json:"version"`
+	Tags    []string     `json:"tags"`
+	Zone    string       `json:"zone"`
+	Weight  int          `json:"weight"`
+	TTL     Duration     `json:"ttl"`
+	Check   *HealthCheck `json:"check"`
+}
+
+// Handler returns the registry HTTP API:
+//
+//	POST   /register                       register or update an instance
+//	GET    /services                       all instances keyed by service name
+//	GET    /services/{name}                instances of one service
+//	DELETE /services/{name}/{id}           deregister an instance
+//	PUT    /services/{name}/{id}/heartbeat renew an instance's TTL
+//	GET    /watch                          Server-Sent Events stream of changes
+//	GET    /cluster                        replication status (404 if not replicated)
+//	GET    /ui                             HTML status page
+//	GET    /metrics                        Prometheus metrics
+//
+// The GET /services endpoints report the registry index in X-Registry-Index
+// and become blocking queries when given ?index=N: they answer once the index
+// moves past N, or after ?wait (default 5m). An N ahead of the registry's
+// index, e.g. from before a restart, is answered at once. With WithPolicy every endpoint
+// is authorised first, except /metrics; wrap the handler in AuthMiddleware to
+// accept tokens.
+func (r *Registry) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /register", r.registerServiceHandler)
+	mux.HandleFunc("GET /services", r.listServicesHandler)
+	mux.HandleFunc("GET /services/{name}", r.listServiceInstancesHandler)
+	mux.HandleFunc("DELETE /services/{name}/{id}", r.deregisterHandler)
+	mux.HandleFunc("PUT /services/{name}/{id}/heartbeat", r.heartbeatHandler)
+	mux.HandleFunc("GET /watch", r.watchHandler)
+	mux.HandleFunc("GET /cluster", r.clusterHandler)
+	mux.HandleFunc("GET /ui", r.uiHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	return mux
+}
 
-	services[serviceName] = append(services[serviceName], Service{
-		Name:    serviceName,
-		Address: address,
-		Status:  "UP",
+func (r *Registry) registerServiceHandler(w http.ResponseWriter, req *http.Request) {
+	var body registerRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !r.authorize(w, req, ActionWrite, body.Service) {
+		return
+	}
+	inst, created, err := r.Register(Service{
+		ID:      body.ID,
+		Name:    body.Service,
+		Address: body.Address,
+		Version: body.Version,
+		Tags:    body.Tags,
+		Zone:    body.Zone,
+		Weight:  body.Weight,
+		TTL:     body.TTL,
+		Check:   body.Check,
 	})
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, inst)
 }
 
-func HealthCheck() {
-	ticker := time.NewTicker(30 * time.Second)
-	for {
-		<-ticker.C
-		mu.Lock()
-		for svcName, instances := range services {
-			for i, inst := range instances {
-				resp, err := http.Get(inst.Address + "/health")
-				if err != nil || resp.StatusCode != 200 {
-					services[svcName][i].Status = "DOWN"
-				} else {
-					services[svcName][i].Status = "UP"
-				}
-			}
+func (r *Registry) listServicesHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.authorize(w, req, ActionRead, "") {
+		return
+	}
+	if !r.blockingQuery(w, req) {
+		return
+	}
+	services, index := r.Snapshot()
+	w.Header().Set("X-Registry-Index", strconv.FormatUint(index, 10))
+	writeJSON(w, http.StatusOK, services)
+}
+
+func (r *Registry) listServiceInstancesHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.authorize(w, req, ActionRead, req.PathValue("name")) {
+		return
+	}
+	if !r.blockingQuery(w, req) {
+		return
+	}
+	services, index := r.Snapshot()
+	instances, ok := services[req.PathValue("name")]
+	w.Header().Set("X-Registry-Index", strconv.FormatUint(index, 10))
+	if !ok {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, instances)
+}
+
+// blockingQuery waits for ?index and ?wait. It returns false after writing an
+// error response.
+func (r *Registry) blockingQuery(w http.ResponseWriter, req *http.Request) bool {
+	q := req.URL.Query()
+	if q.Get("index") == "" {
+		return true
+	}
+	index, err := strconv.ParseUint(q.Get("index"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid index", http.StatusBadRequest)
+		return false
+	}
+	wait := defaultWait
+	if v := q.Get("wait"); v != "" {
+		if wait, err = time.ParseDuration(v); err != nil || wait <= 0 {
+			http.Error(w, "Invalid wait", http.StatusBadRequest)
+			return false
 		}
-		mu.Unlock()
+		wait = min(wait, maxWait)
 	}
+	ctx, cancel := context.WithTimeout(req.Context(), wait)
+	defer cancel()
+	r.Wait(ctx, index)
+	return true
 }
 
-func main() {
-	// Start health checks in background
-	go HealthCheck()
+// watchHandler streams changes as Server-Sent Events. Each change is an event
+// whose id is its index, whose name is the event type and whose data is the
+// Event as JSON. A new watcher, or one resuming (Last-Event-ID or ?index) from
+// an index that is no longer retained or that is ahead of the registry's,
+// first gets a "snapshot" event holding
+// {"index": N, "services": {...}}. ?service=NAME only streams that service.
+func (r *Registry) watchHandler(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	name := req.URL.Query().Get("service")
+	if !r.authorize(w, req, ActionRead, name) {
+		return
+	}
+	from := req.Header.Get("Last-Event-ID")
+	if from == "" {
+		from = req.URL.Query().Get("index")
+	}
+	var index uint64
+	resume := from != ""
+	if resume {
+		var err error
+		if index, err = strconv.ParseUint(from, 10, 64); err != nil {
+			http.Error(w, "Invalid index", http.StatusBadRequest)
+			return
+		}
+	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/register", registerServiceHandler)
-	mux.HandleFunc("/services", listServicesHandler)
-	mux.HandleFunc("/services/", listServiceInstancesHandler)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
 
-	srv := &http.Server{
-		Addr:    ":8000",
-		Handler: mux,
+	snapshot := func() error {
+		services, current := r.Snapshot()
+		if name != "" {
+			filtered := map[string][]Service{}
+			if instances, ok := services[name]; ok {
+				filtered[name] = instances
+			}
+			services = filtered
+		}
+		index = current
+		return writeEvent(w, current, "snapshot", map[string]interface{}{"index": current, "services": services})
 	}
+	if !resume {
+		if err := snapshot(); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ctx := req.Context()
+	for {
+		events, ok := r.EventsSince(index)
+		if !ok {
+			if snapshot() != nil {
+				return
+			}
+		}
+		for _, e := range events {
+			index = e.Index
+			if name != "" && e.Service.Name != name {
+				continue
+			}
+			if writeEvent(w, e.Index, string(e.Type), e) != nil {
+				return
+			}
+		}
+		flusher.Flush()
 
-	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("Registry server failed: %v", err)
+		waitCtx, cancel := context.WithTimeout(ctx, keepAliveInterval)
+		current := r.Wait(waitCtx, index)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if current == index {
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
 		}
-	}()
-
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down registry server...")
-	srv.Close()
+	}
 }
 
-func registerServiceHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
+func writeEvent(w http.ResponseWriter, id uint64, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
-	var req struct {
-		Service string `json:"service"`
-		Address string `json:"address"`
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
+	return err
+}
+
+func (r *Registry) deregisterHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.authorize(w, req, ActionWrite, req.PathValue("name")) {
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := r.Deregister(req.PathValue("name"), req.PathValue("id")); err != nil {
+		writeError(w, req, err)
 		return
 	}
-	RegisterService(req.Service, req.Address)
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func listServicesHandler(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-	json.NewEncoder(w).Encode(services)
+func (r *Registry) heartbeatHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.authorize(w, req, ActionWrite, req.PathValue("name")) {
+		return
+	}
+	inst, err := r.Heartbeat(req.PathValue("name"), req.PathValue("id"))
+	if err != nil {
+		// ErrNotFound: the instance expired or was never registered; it must
+		// register again.
+		writeError(w, req, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, inst)
 }
 
-func listServiceInstancesHandler(w http.ResponseWriter, r *http.Request) {
-	// URL: /services/{name}
-	name := r.URL.Path[len("/services/"):]
-	mu.RLock()
-	defer mu.RUnlock()
-	instances, ok := services[name]
-	if !ok {
-		http.Error(w, "Service not found", http.StatusNotFound)
+func (r *Registry) clusterHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.authorize(w, req, ActionRead, "") {
+		return
+	}
+	status := r.Cluster()
+	if status == nil {
+		http.Error(w, "Registry is not replicated", http.StatusNotFound)
 		return
 	}
-	json.NewEncoder(w).Encode(instances)
+	writeJSON(w, http.StatusOK, status)
+}
+
+// writeError answers a failed write. Followers redirect writes to the leader
+// with 307 so that clients resend the same method and body there.
+func writeError(w http.ResponseWriter, req *http.Request, err error) {
+	var notLeader *NotLeaderError
+	switch {
+	case errors.As(err, &notLeader) && notLeader.LeaderURL != "":
+		http.Redirect(w, req, notLeader.LeaderURL+req.URL.RequestURI(), http.StatusTemporaryRedirect)
+	case errors.As(err, &notLeader):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "Instance not found", http.StatusNotFound)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
@@ -0,0 +1,54 @@
+package registry
+
+import "sync"
+
+// Store persists registered instances so that a registry keeps them across
+// restarts. The registry writes every change through to its store and loads
+// it once in New. Implementations must be safe for concurrent use.
+type Store interface {
+	Load() ([]Service, error)
+	Put(s Service) error
+	Delete(name, id string) error
+	Close() error
+}
+
+// MemoryStore keeps instances in memory only; it is the default Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	instances map[string]Service
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{instances: make(map[string]Service)}
+}
+
+func (m *MemoryStore) Load() ([]Service, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Service, 0, len(m.instances))
+	for _, s := range m.instances {
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) Put(s Service) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[storeKey(s.Name, s.ID)] = s
+	return nil
+}
+
+func (m *MemoryStore) Delete(name, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.instances, storeKey(name, id))
+	return nil
+}
+
+func (m *MemoryStore) Close() error { return nil }
+
+func storeKey(name, id string) string {
+	return name + "/" + id
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// uiTemplate renders the status page. It refreshes itself every 10 seconds.
+var uiTemplate = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"ago": func(now time.Time, t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return now.Sub(*t).Round(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>Service Registry</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; }
+th { background: #f4f4f4; }
+.UP { color: #1a7f37; font-weight: bold; }
+.DOWN { color: #cf222e; font-weight: bold; }
+.error { color: #cf222e; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+<h1>Service Registry</h1>
+<p class="muted">Index {{.Index}}{{with .Cluster}} &middot; node {{.ID}} ({{.State}}), leader {{if .LeaderID}}{{.LeaderID}}{{else}}unknown{{end}}{{end}} &middot; {{.Now.Format "2006-01-02 15:04:05 MST"}}</p>
+{{if not .Services}}<p>No services registered.</p>{{end}}
+{{range .Services}}
+<h2>{{.Name}} <span class="muted">{{.Up}}/{{len .Instances}} up</span></h2>
+<table>
+<tr><th>Instance</th><th>Address</th><th>Status</th><th>Version</th><th>Zone</th><th>Weight</th><th>Last check</th><th>Failures</th><th>Last error</th><th>Last heartbeat</th></tr>
+{{range .Instances}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{.Address}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{.Version}}</td>
+<td>{{.Zone}}</td>
+<td>{{.Weight}}</td>
+<td>{{ago $.Now .LastCheck}}</td>
+<td>{{.ConsecutiveFailures}}</td>
+<td class="error">{{.LastError}}</td>
+<td>{{ago $.Now .LastHeartbeat}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+type uiService struct {
+	Name      string
+	Up        int
+	Instances []uiInstance
+}
+
+// uiInstance is a Service with LastHeartbeat as a pointer, so that the
+// template can format it like LastCheck.
+type uiInstance struct {
+	Service
+	LastHeartbeat *time.Time
+}
+
+// uiHandler serves a human-readable status page listing every service, its
+// instances and the outcome of their last health check.
+func (r *Registry) uiHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.authorize(w, req, ActionRead, "") {
+		return
+	}
+	services, index := r.Snapshot()
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := struct {
+		Index    uint64
+		Now      time.Time
+		Cluster  *ClusterStatus
+		Services []uiService
+	}{Index: index, Now: r.now(), Cluster: r.Cluster()}
+	for _, name := range names {
+		svc := uiService{Name: name}
+		for _, inst := range services[name] {
+			if inst.Status == StatusUp {
+				svc.Up++
+			}
+			heartbeat := inst.LastHeartbeat
+			svc.Instances = append(svc.Instances, uiInstance{Service: inst, LastHeartbeat: &heartbeat})
+		}
+		sort.Slice(svc.Instances, func(i, j int) bool { return svc.Instances[i].ID < svc.Instances[j].ID })
+		data.Services = append(data.Services, svc)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := uiTemplate.Execute(w, data); err != nil {
+		log.Printf("Rendering registry UI: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"context"
+	"slices"
+)
+
+// EventType says what happened to an instance.
+type EventType string
+
+const (
+	EventAdded   EventType = "added"
+	EventUpdated EventType = "updated"
+	EventRemoved EventType = "removed"
+	// EventStatus is an UP/DOWN flip decided by health checks.
+	EventStatus EventType = "status"
+)
+
+// maxEvents is how many past events are kept for watchers that resume from an
+// index. Older watchers have to resynchronise from a snapshot.
+const maxEvents = 1024
+
+// Event is one change to the registry. Index increases by one per event.
+type Event struct {
+	Index   uint64    `json:"index"`
+	Type    EventType `json:"type"`
+	Service Service   `json:"service"`
+}
+
+// publishLocked records an event and wakes every waiter. r.mu must be held
+// for writing.
+func (r *Registry) publishLocked(typ EventType, s Service) {
+	r.index++
+	r.events = append(r.events, Event{Index: r.index, Type: typ, Service: s})
+	if len(r.events) > maxEvents {
+		r.events = append(r.events[:0:0], r.events[len(r.events)-maxEvents:]...)
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Index returns the index of the latest change; it is 0 until something has
+// changed.
+func (r *Registry) Index() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.index
+}
+
+// EventsSince returns the events after index. ok is false when some of them
+// are no longer retained, or when index is ahead of the registry, e.g. it
+// came from before a restart or from another node; the caller must then
+// start over from Services.
+func (r *Registry) EventsSince(index uint64) (events []Event, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if index > r.index {
+		return nil, false
+	}
+	if index == r.index {
+		return nil, true
+	}
+	if len(r.events) == 0 || r.events[0].Index > index+1 {
+		return nil, false
+	}
+	i, _ := slices.BinarySearchFunc(r.events, index+1, func(e Event, target uint64) int {
+		switch {
+		case e.Index < target:
+			return -1
+		case e.Index > target:
+			return 1
+		}
+		return 0
+	})
+	return append([]Event(nil), r.events[i:]...), true
+}
+
+// Wait blocks until the registry index is no longer index or ctx is done,
+// and returns the current index. An index ahead of the registry's returns at
+// once.
+func (r *Registry) Wait(ctx context.Context, index uint64) uint64 {
+	for {
+		r.mu.RLock()
+		current, changed := r.index, r.changed
+		r.mu.RUnlock()
+		if current != index {
+			return current
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return current
+		}
+	}
+}
+
+// sameRegistration reports whether re-registering b over a changes anything
+// watchers care about.
+func sameRegistration(a, b Service) bool {
+	return a.Address == b.Address && a.Version == b.Version && a.Zone == b.Zone &&
+		a.Weight == b.Weight && a.TTL == b.TTL && slices.Equal(a.Tags, b.Tags) &&
+		sameCheck(a.Check, b.Check)
+}
+
+func sameCheck(a, b *HealthCheck) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
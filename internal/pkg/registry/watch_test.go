@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsSince(t *testing.T) {
+	r := newTestRegistry(t)
+	a, _, _ := r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	r.Register(Service{Name: "orders", Address: "http://10.0.0.2:8082"})
+	r.Deregister("orders", a.ID)
+
+	events, ok := r.EventsSince(1)
+	if !ok || len(events) != 2 || events[0].Type != EventAdded || events[1].Type != EventRemoved || events[1].Index != 3 {
+		t.Errorf("EventsSince(1) = %+v, %v", events, ok)
+	}
+	if events, ok := r.EventsSince(3); !ok || len(events) != 0 {
+		t.Errorf("EventsSince(current) = %+v, %v; want nothing, ok", events, ok)
+	}
+	// An index from a previous incarnation of the registry, or from another
+	// node, is stale rather than up to date.
+	if _, ok := r.EventsSince(10); ok {
+		t.Error("EventsSince(index ahead of the registry) is ok, want a snapshot")
+	}
+}
+
+func TestWait(t *testing.T) {
+	r := newTestRegistry(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	}()
+	if got := r.Wait(ctx, 0); got != 1 {
+		t.Errorf("Wait(0) = %d after a registration, want 1", got)
+	}
+
+	start := time.Now()
+	if got := r.Wait(ctx, 42); got != 1 || time.Since(start) > time.Second {
+		t.Errorf("Wait(42) = %d after %v, want 1 at once", got, time.Since(start))
+	}
+}
+
+func TestBlockingQuery(t *testing.T) {
+	r := newTestRegistry(t)
+	r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/services?index=99&wait=5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if time.Since(start) > 2*time.Second || resp.Header.Get("X-Registry-Index") != "1" {
+		t.Errorf("query ahead of the index answered after %v with index %s, want at once with 1",
+			time.Since(start), resp.Header.Get("X-Registry-Index"))
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		r.Register(Service{Name: "orders", Address: "http://10.0.0.2:8082"})
+	}()
+	resp, err = http.Get(srv.URL + "/services/orders?index=1&wait=5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Registry-Index") != "2" {
+		t.Errorf("blocking query returned index %s, want 2", resp.Header.Get("X-Registry-Index"))
+	}
+}
+
+func TestWatchResumeAheadGetsSnapshot(t *testing.T) {
+	r := newTestRegistry(t)
+	r.Register(Service{Name: "orders", Address: "http://10.0.0.1:8082"})
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/watch", nil)
+	req.Header.Set("Last-Event-ID", "500")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := bufio.NewScanner(resp.Body)
+	var got []string
+	for len(got) < 2 && lines.Scan() {
+		if line := lines.Text(); line != "" {
+			got = append(got, line)
+		}
+	}
+	if len(got) < 2 || got[0] != "id: 1" || got[1] != "event: snapshot" {
+		t.Fatalf("stream resumed from an index ahead of the registry starts with %q, want a snapshot at index 1", got)
+	}
+	if !lines.Scan() || !strings.Contains(lines.Text(), "10.0.0.1:8082") {
+		t.Errorf("snapshot data %q lacks the registered instance", lines.Text())
+	}
+}
@@ -21,7 +21,24 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
+// Audiences of the tokens signed with JWT_SECRET. Each validator only accepts
+// tokens issued for it, so that a registry token cannot call the services and
+// a user's token cannot write to the registry.
+const (
+	AudienceAPI      = "scalebit-api"
+	AudienceRegistry = "scalebit-registry"
+)
+
+// JWTValidationMiddleware rejects requests without a valid token for the
+// services (AudienceAPI).
 func JWTValidationMiddleware(next http.Handler) http.Handler {
+	return JWTAudienceMiddleware(next, AudienceAPI)
+}
+
+// JWTAudienceMiddleware rejects requests without a valid token issued for
+// audience, and passes the claims of the others on as the "user" context
+// value.
+func JWTAudienceMiddleware(next http.Handler, audience string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenStr := extractToken(r)
 		if tokenStr == "" {
@@ -34,7 +51,7 @@ func JWTValidationMiddleware(next http.Handler) http.Handler {
 				return nil, fmt.Errorf("unexpected signing method")
 			}
 			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		}, jwt.WithAudience(audience))
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -49,6 +66,23 @@ func JWTValidationMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// JWTValidationMiddlewareExcept behaves like JWTValidationMiddleware but serves
+// requests for the given exact paths without checking for a token.
+func JWTValidationMiddlewareExcept(next http.Handler, publicPaths ...string) http.Handler {
+	public := make(map[string]bool, len(publicPaths))
+	for _, p := range publicPaths {
+		public[p] = true
+	}
+	protected := JWTValidationMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if public[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
 func VaultSecretInjector() middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
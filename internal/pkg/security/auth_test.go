@@ -0,0 +1,56 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signed(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJWTValidationMiddlewareAudience(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	handler := JWTValidationMiddlewareExcept(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("user").(jwt.MapClaims); !ok && r.URL.Path != "/health" {
+			t.Error("claims missing from the context")
+		}
+	}), "/health")
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"user token", "/orders", signed(t, "test-secret", jwt.MapClaims{"id": 1, "aud": AudienceAPI}), http.StatusOK},
+		{"registry token", "/orders", signed(t, "test-secret", jwt.MapClaims{"sub": "service:orders", "scope": "registry:admin", "aud": AudienceRegistry}), http.StatusUnauthorized},
+		{"token without an audience", "/orders", signed(t, "test-secret", jwt.MapClaims{"id": 1}), http.StatusUnauthorized},
+		{"token signed with another secret", "/orders", signed(t, "other-secret", jwt.MapClaims{"id": 1, "aud": AudienceAPI}), http.StatusUnauthorized},
+		{"no token", "/orders", "", http.StatusUnauthorized},
+		{"public path", "/health", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -13,6 +14,8 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+	regclient "github.com/moodykhalif23/scalebit/internal/pkg/registry/client"
 	"github.com/moodykhalif23/scalebit/internal/pkg/security"
 	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
 
@@ -32,6 +35,17 @@ type Order struct {
 }
 
 func main() {
+	printSpec := flag.Bool("openapi", false, "print the OpenAPI document and exit")
+	flag.Parse()
+	if *printSpec {
+		data, err := openapi.Marshal(apiSpec())
+		if err != nil {
+			log.Fatalf("Failed to render OpenAPI document: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	tp := initTracer()
 	defer tp.Shutdown(context.Background())
 
@@ -48,6 +62,7 @@ func main() {
 		w.Write([]byte("ok"))
 	}).Methods("GET")
 	publicRouter.Handle("/metrics", promhttp.Handler())
+	publicRouter.HandleFunc("/openapi.json", openapi.Handler(apiSpec())).Methods("GET")
 
 	orderRouter := publicRouter.PathPrefix("/orders").Subrouter()
 	orderRouter.HandleFunc("", getOrders(db)).Methods("GET")
@@ -56,7 +71,7 @@ func main() {
 	orderRouter.HandleFunc("/{id:[0-9]+}", updateOrder(db)).Methods("PUT")
 	orderRouter.HandleFunc("/{id:[0-9]+}", deleteOrder(db)).Methods("DELETE")
 
-	handler := telemetry.Middleware(security.JWTValidationMiddleware(publicRouter))
+	handler := telemetry.Middleware(security.JWTValidationMiddlewareExcept(publicRouter, "/health", "/openapi.json"))
 
 	srv := &http.Server{
 		Addr:    ":8082",
@@ -69,11 +84,17 @@ func main() {
 		}
 	}()
 
+	registration := regclient.RegisterFromEnv(context.Background(), "order-service", "8082")
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	// Leave the registry first so that no new traffic is sent our way.
+	if err := registration.Deregister(ctx); err != nil {
+		log.Printf("Registry deregistration failed: %v", err)
+	}
 	srv.Shutdown(ctx)
 }
 
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+)
+
+// apiRoutes describes the routes registered in main. Keep the two in sync and
+// regenerate api/openapi with `scalebit-cli openapi generate`.
+var apiRoutes = []openapi.Route{
+	{Method: "GET", Path: "/health", Summary: "Liveness probe", Public: true, Internal: true},
+	{Method: "GET", Path: "/orders", Summary: "List orders", Response: []Order{}},
+	{Method: "POST", Path: "/orders", Summary: "Create an order", Request: Order{}, Response: Order{}},
+	{Method: "GET", Path: "/orders/{id:[0-9]+}", Summary: "Get an order", Response: Order{}},
+	{Method: "PUT", Path: "/orders/{id:[0-9]+}", Summary: "Update an order", Request: Order{}, Response: Order{}},
+	{Method: "DELETE", Path: "/orders/{id:[0-9]+}", Summary: "Delete an order", Status: http.StatusNoContent},
+}
+
+func apiSpec() *openapi.Document {
+	return openapi.Build("order-service", "1.0.0", apiRoutes)
+}
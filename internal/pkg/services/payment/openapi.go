@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+)
+
+// apiRoutes describes the routes registered in main. Keep the two in sync and
+// regenerate api/openapi with `scalebit-cli openapi generate`.
+var apiRoutes = []openapi.Route{
+	{Method: "GET", Path: "/health", Summary: "Liveness probe", Public: true, Internal: true},
+	{Method: "GET", Path: "/payments", Summary: "List payments", Response: []Payment{}},
+	{Method: "POST", Path: "/payments", Summary: "Create a payment", Request: Payment{}, Response: Payment{}},
+	{Method: "GET", Path: "/payments/{id:[0-9]+}", Summary: "Get a payment", Response: Payment{}},
+	{Method: "PUT", Path: "/payments/{id:[0-9]+}", Summary: "Update a payment", Request: Payment{}, Response: Payment{}},
+	{Method: "DELETE", Path: "/payments/{id:[0-9]+}", Summary: "Delete a payment", Status: http.StatusNoContent},
+}
+
+func apiSpec() *openapi.Document {
+	return openapi.Build("payment-service", "1.0.0", apiRoutes)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+)
+
+// apiRoutes describes the routes registered in main. Keep the two in sync and
+// regenerate api/openapi with `scalebit-cli openapi generate`.
+var apiRoutes = []openapi.Route{
+	{Method: "GET", Path: "/health", Summary: "Liveness probe", Public: true, Internal: true},
+	{Method: "GET", Path: "/products", Summary: "List products", Response: []Product{}},
+	{Method: "POST", Path: "/products", Summary: "Create a product", Request: Product{}, Response: Product{}},
+	{Method: "GET", Path: "/products/{id:[0-9]+}", Summary: "Get a product", Response: Product{}},
+	{Method: "PUT", Path: "/products/{id:[0-9]+}", Summary: "Update a product", Request: Product{}, Response: Product{}},
+	{Method: "DELETE", Path: "/products/{id:[0-9]+}", Summary: "Delete a product", Status: http.StatusNoContent},
+}
+
+func apiSpec() *openapi.Document {
+	return openapi.Build("product-service", "1.0.0", apiRoutes)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -23,6 +25,8 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/gorilla/mux"
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+	regclient "github.com/moodykhalif23/scalebit/internal/pkg/registry/client"
 	"github.com/moodykhalif23/scalebit/internal/pkg/security"
 	"github.com/moodykhalif23/scalebit/internal/pkg/telemetry"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -39,6 +43,14 @@ type RegisterRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+}
+
+// CreateUserRequest is RegisterRequest for POST /users, where admins may
+// choose the role.
+type CreateUserRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
 	Role     string `json:"role,omitempty"`
 }
 
@@ -47,7 +59,23 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type LoginResponse struct {
+	Token string `json:"token"`
+	Role  string `json:"role"`
+}
+
 func main() {
+	printSpec := flag.Bool("openapi", false, "print the OpenAPI document and exit")
+	flag.Parse()
+	if *printSpec {
+		data, err := openapi.Marshal(apiSpec())
+		if err != nil {
+			log.Fatalf("Failed to render OpenAPI document: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	tp := initTracer()
 	defer tp.Shutdown(context.Background())
 
@@ -70,10 +98,12 @@ func main() {
 
 	// Prometheus metrics endpoint
 	publicRouter.Handle("/metrics", promhttp.Handler())
+	publicRouter.HandleFunc("/openapi.json", openapi.Handler(apiSpec())).Methods("GET")
 
 	// Register public auth routes
 	publicRouter.HandleFunc("/register", registerHandler(db)).Methods("POST", "OPTIONS")
 	publicRouter.HandleFunc("/login", loginHandler(db)).Methods("POST", "OPTIONS")
+	publicRouter.HandleFunc("/refresh", refreshHandler(db)).Methods("POST", "OPTIONS")
 	publicRouter.HandleFunc("/debug-jwt", debugJWTHandler()).Methods("GET", "OPTIONS")
 
 	userRouter := publicRouter.PathPrefix("/users").Subrouter()
@@ -84,7 +114,7 @@ func main() {
 	userRouter.HandleFunc("/{id:[0-9]+}", deleteUser(db)).Methods("DELETE")
 
 	// CORS middleware to all routes
-	handler := telemetry.Middleware(corsMiddleware(security.JWTValidationMiddleware(publicRouter)))
+	handler := telemetry.Middleware(corsMiddleware(security.JWTValidationMiddlewareExcept(publicRouter, "/health", "/openapi.json", "/register", "/login")))
 
 	srv := &http.Server{
 		Addr:    ":8080",
@@ -97,12 +127,18 @@ func main() {
 		}
 	}()
 
+	registration := regclient.RegisterFromEnv(context.Background(), "user-service", "8080")
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	// Leave the registry first so that no new traffic is sent our way.
+	if err := registration.Deregister(ctx); err != nil {
+		log.Printf("Registry deregistration failed: %v", err)
+	}
 	srv.Shutdown(ctx)
 }
 
@@ -178,7 +214,7 @@ func getUsers(db *sql.DB) http.HandlerFunc {
 // Update createUser to require password and hash it
 func createUser(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req RegisterRequest
+		var req CreateUserRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -191,6 +227,10 @@ func createUser(db *sql.DB) http.HandlerFunc {
 		if role == "" {
 			role = "user"
 		}
+		if claims, _ := r.Context().Value("user").(jwt.MapClaims); role != "user" && claims["role"] != "admin" {
+			http.Error(w, "Only admins may choose the role", http.StatusForbidden)
+			return
+		}
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
@@ -268,10 +308,8 @@ func registerHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "All fields required", http.StatusBadRequest)
 			return
 		}
-		role := req.Role
-		if role == "" {
-			role = "user"
-		}
+		// Self-registered accounts are always plain users.
+		role := "user"
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
@@ -319,34 +357,72 @@ func loginHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
-		// Create JWT
-		jwtSecret := os.Getenv("JWT_SECRET")
-		if jwtSecret == "" {
-			http.Error(w, "JWT secret not set", http.StatusInternalServerError)
+		tokenString, err := issueToken(id, name, email, role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(LoginResponse{Token: tokenString, Role: role})
+	}
+}
+
+// issueToken creates the signed JWT returned by /login and /refresh.
+func issueToken(id int, name, email, role string) (string, error) {
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		return "", fmt.Errorf("JWT secret not set")
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"id":    id,
+		"name":  name,
+		"email": email,
+		"role":  role,
+		"iat":   now.Unix(),
+		"exp":   now.Add(24 * time.Hour).Unix(),
+		"iss":   "scalebit-platform",
+		"aud":   security.AudienceAPI,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims))
+	// Set the kid in the header for KrakenD validation
+	token.Header["kid"] = "scalebit-key-1"
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return tokenString, nil
+}
+
+// refreshHandler issues a fresh token for the still-valid token the request
+// was authenticated with, re-reading the user so role changes take effect.
+func refreshHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value("user").(jwt.MapClaims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		rawID, ok := claims["id"].(float64)
+		if !ok {
+			http.Error(w, "Token has no user id", http.StatusUnauthorized)
+			return
+		}
+		var id int
+		var name, email, role string
+		err := db.QueryRow("SELECT id, name, email, role FROM users WHERE id = $1", int(rawID)).Scan(&id, &name, &email, &role)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User no longer exists", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Using JWT secret: %s", jwtSecret)
-		now := time.Now()
-		claims := map[string]interface{}{
-			"id":    id,
-			"name":  name,
-			"email": email,
-			"role":  role,
-			"iat":   now.Unix(),
-			"exp":   now.Add(24 * time.Hour).Unix(),
-			"iss":   "scalebit-platform",
-			"aud":   "scalebit-api",
-		}
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims))
-		// Set the kid in the header for KrakenD validation
-		token.Header["kid"] = "scalebit-key-1"
-		log.Printf("Generated JWT claims: %+v", claims)
-		tokenString, err := token.SignedString([]byte(jwtSecret))
+		tokenString, err := issueToken(id, name, email, role)
 		if err != nil {
-			http.Error(w, "Failed to sign token", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(map[string]string{"token": tokenString, "role": role})
+		json.NewEncoder(w).Encode(LoginResponse{Token: tokenString, Role: role})
 	}
 }
 
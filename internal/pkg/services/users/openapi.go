@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/moodykhalif23/scalebit/internal/pkg/openapi"
+)
+
+// apiRoutes describes the routes registered in main. Keep the two in sync and
+// regenerate api/openapi with `scalebit-cli openapi generate`.
+var apiRoutes = []openapi.Route{
+	{Method: "GET", Path: "/health", Summary: "Liveness probe", Public: true, Internal: true},
+	{Method: "POST", Path: "/register", Summary: "Register a new account", Request: RegisterRequest{}, Response: User{}, Status: http.StatusCreated, Public: true},
+	{Method: "POST", Path: "/login", Summary: "Exchange credentials for a JWT", Request: LoginRequest{}, Response: LoginResponse{}, Public: true},
+	{Method: "POST", Path: "/refresh", Summary: "Exchange a valid JWT for one with a later expiry", Response: LoginResponse{}},
+	{Method: "GET", Path: "/debug-jwt", Summary: "Show the claims of the caller's JWT", Response: map[string]interface{}{}, Internal: true},
+	{Method: "GET", Path: "/users", Summary: "List users", Response: []User{}},
+	{Method: "POST", Path: "/users", Summary: "Create a user", Request: CreateUserRequest{}, Response: User{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/users/{id:[0-9]+}", Summary: "Get a user", Response: User{}},
+	{Method: "PUT", Path: "/users/{id:[0-9]+}", Summary: "Update a user", Request: User{}, Response: User{}},
+	{Method: "DELETE", Path: "/users/{id:[0-9]+}", Summary: "Delete a user", Status: http.StatusNoContent},
+}
+
+func apiSpec() *openapi.Document {
+	return openapi.Build("user-service", "1.0.0", apiRoutes)
+}
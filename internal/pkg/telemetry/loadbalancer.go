@@ -0,0 +1,74 @@
+package telemetry
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Load balancer metrics. They are safe to use before registration and are
+// exported once RegisterLoadBalancerMetrics is called.
+var (
+	LoadBalancerBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "loadbalancer_circuit_breaker_state",
+		Help: "Circuit breaker state per backend: 0 closed, 1 half-open, 2 open",
+	}, []string{"route", "backend"})
+
+	LoadBalancerBreakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loadbalancer_circuit_breaker_transitions_total",
+		Help: "Circuit breaker state changes, by the state entered",
+	}, []string{"route", "backend", "state"})
+
+	LoadBalancerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loadbalancer_requests_total",
+		Help: "Requests answered per route, by status code",
+	}, []string{"route", "code"})
+
+	LoadBalancerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "loadbalancer_request_duration_seconds",
+		Help:    "Time to answer a request per route, retries included",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	LoadBalancerUpstreamResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loadbalancer_upstream_responses_total",
+		Help: "Responses received from each backend, by status code",
+	}, []string{"route", "backend", "code"})
+
+	LoadBalancerUpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "loadbalancer_upstream_duration_seconds",
+		Help:    "Time until each backend sent its response headers",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "backend"})
+
+	LoadBalancerUpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loadbalancer_upstream_errors_total",
+		Help: "Requests for which a backend could not be reached or did not answer",
+	}, []string{"route", "backend"})
+
+	LoadBalancerCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loadbalancer_cache_requests_total",
+		Help: "Requests to caching routes, by cache result: hit, miss, revalidated, coalesced or bypass",
+	}, []string{"route", "result"})
+
+	LoadBalancerCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loadbalancer_cache_bytes",
+		Help: "Approximate size of the cached responses",
+	})
+)
+
+// RegisterLoadBalancerMetrics adds the load balancer metrics to reg.
+func RegisterLoadBalancerMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		LoadBalancerBreakerState,
+		LoadBalancerBreakerTransitions,
+		LoadBalancerRequests,
+		LoadBalancerRequestDuration,
+		LoadBalancerUpstreamResponses,
+		LoadBalancerUpstreamDuration,
+		LoadBalancerUpstreamErrors,
+		LoadBalancerCacheRequests,
+		LoadBalancerCacheBytes,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
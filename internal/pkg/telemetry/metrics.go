@@ -22,6 +22,12 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the Flusher and Hijacker of
+// the underlying writer, which proxies need for streaming and upgrades.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 var (
 	HttpRequestDuration metric.Float64Histogram
 	ErrorCount          metric.Int64Counter
@@ -0,0 +1,49 @@
+package telemetry
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Service registry metrics. They are safe to use before registration and are
+// exported once RegisterRegistryMetrics is called.
+var (
+	RegistryInstances = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "registry_instances",
+		Help: "Registered instances per service and status",
+	}, []string{"service", "status"})
+
+	RegistryHealthCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "registry_health_check_duration_seconds",
+		Help:    "Duration of instance health checks",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "protocol", "result"})
+
+	RegistryStatusChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "registry_status_changes_total",
+		Help: "Instances flipping between UP and DOWN, by the status they moved to",
+	}, []string{"service", "status"})
+
+	RegistryRegistrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "registry_registrations_total",
+		Help: "Successful registrations, including re-registrations",
+	}, []string{"service"})
+
+	RegistryDeregistrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "registry_deregistrations_total",
+		Help: "Instances removed, by reason (deregister or expired)",
+	}, []string{"service", "reason"})
+)
+
+// RegisterRegistryMetrics adds the service registry metrics to reg.
+func RegisterRegistryMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		RegistryInstances,
+		RegistryHealthCheckDuration,
+		RegistryStatusChanges,
+		RegistryRegistrations,
+		RegistryDeregistrations,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewRejectsRelativeBaseURL(t *testing.T) {
+	for _, raw := range []string{"", "user-service:8080", "/users"} {
+		if _, err := New(raw); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestUsersLogin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/login" {
+			t.Errorf("got %s %s, want POST /login", r.Method, r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var req LoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Email != "ann@example.com" || req.Password != "secret" {
+			t.Errorf("got credentials %+v", req)
+		}
+		json.NewEncoder(w).Encode(LoginResponse{Token: "tok", Role: "user"})
+	}))
+	defer srv.Close()
+
+	users, err := NewUsersClient(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := users.Login(context.Background(), "ann@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Token != "tok" || res.Role != "user" {
+		t.Errorf("got %+v", res)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	var auth atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode([]Order{{ID: 1}})
+	}))
+	defer srv.Close()
+
+	orders, _ := NewOrdersClient(srv.URL, WithToken("abc"))
+	if _, err := orders.List(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := auth.Load(); got != "Bearer abc" {
+		t.Errorf("Authorization = %q, want Bearer abc", got)
+	}
+
+	orders, _ = NewOrdersClient(srv.URL, WithTokenSource(func(context.Context) (string, error) { return "", nil }))
+	if _, err := orders.List(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := auth.Load(); got != "" {
+		t.Errorf("Authorization = %q, want none for an empty token", got)
+	}
+
+	fail := errors.New("no token")
+	orders, _ = NewOrdersClient(srv.URL, WithRetries(0, 0), WithTokenSource(func(context.Context) (string, error) { return "", fail }))
+	if _, err := orders.List(context.Background()); !errors.Is(err, fail) {
+		t.Errorf("got %v, want the token source's error", err)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/products/1":
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case "/products/2":
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	products, _ := NewProductsClient(srv.URL)
+
+	_, err := products.Get(context.Background(), 1)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Product not found" {
+		t.Fatalf("got %v, want a 404 *Error", err)
+	}
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrServer) {
+		t.Errorf("errors.Is does not match the status of %v", err)
+	}
+	if _, err := products.Get(context.Background(), 2); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got %v, want ErrUnauthorized", err)
+	}
+	if err := products.Delete(context.Background(), 3); err != nil {
+		t.Errorf("Delete with 204: %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(Payment{ID: 7})
+	}))
+	defer srv.Close()
+	payments, _ := NewPaymentsClient(srv.URL, WithRetries(2, time.Millisecond))
+
+	p, err := payments.Get(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 7 || calls.Load() != 3 {
+		t.Errorf("got payment %d after %d calls, want 7 after 3", p.ID, calls.Load())
+	}
+
+	// POST is not idempotent: one attempt only.
+	calls.Store(0)
+	if _, err := payments.Create(context.Background(), Payment{}); !errors.Is(err, ErrServer) {
+		t.Errorf("got %v, want the 503", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("POST was sent %d times, want 1", calls.Load())
+	}
+
+	// The last error is returned once the retries run out.
+	calls.Store(-10)
+	if _, err := payments.Get(context.Background(), 7); !errors.Is(err, ErrServer) {
+		t.Errorf("got %v, want the 503", err)
+	}
+	if calls.Load() != -7 {
+		t.Errorf("GET was sent %d times, want 3", calls.Load()+10)
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	orders, _ := NewOrdersClient(srv.URL, WithRetries(5, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := orders.List(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context's error", err)
+	}
+}
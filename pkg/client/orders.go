@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Order mirrors the order service's Order resource.
+type Order struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	ProductID int    `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Status    string `json:"status"`
+}
+
+// OrdersClient talks to the order service.
+type OrdersClient struct {
+	c *Client
+}
+
+// NewOrdersClient creates a client for the order service at baseURL.
+func NewOrdersClient(baseURL string, opts ...Option) (*OrdersClient, error) {
+	c, err := New(baseURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &OrdersClient{c: c}, nil
+}
+
+func (s *OrdersClient) List(ctx context.Context) ([]Order, error) {
+	var out []Order
+	if err := s.c.Do(ctx, http.MethodGet, "/orders", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *OrdersClient) Get(ctx context.Context, id int) (*Order, error) {
+	var out Order
+	if err := s.c.Do(ctx, http.MethodGet, fmt.Sprintf("/orders/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *OrdersClient) Create(ctx context.Context, in Order) (*Order, error) {
+	var out Order
+	if err := s.c.Do(ctx, http.MethodPost, "/orders", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *OrdersClient) Update(ctx context.Context, id int, in Order) (*Order, error) {
+	var out Order
+	if err := s.c.Do(ctx, http.MethodPut, fmt.Sprintf("/orders/%d", id), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *OrdersClient) Delete(ctx context.Context, id int) error {
+	return s.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/orders/%d", id), nil, nil)
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Payment mirrors the payment service's Payment resource.
+type Payment struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	Amount    float64   `json:"amount"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PaymentsClient talks to the payment service.
+type PaymentsClient struct {
+	c *Client
+}
+
+// NewPaymentsClient creates a client for the payment service at baseURL.
+func NewPaymentsClient(baseURL string, opts ...Option) (*PaymentsClient, error) {
+	c, err := New(baseURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentsClient{c: c}, nil
+}
+
+func (s *PaymentsClient) List(ctx context.Context) ([]Payment, error) {
+	var out []Payment
+	if err := s.c.Do(ctx, http.MethodGet, "/payments", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *PaymentsClient) Get(ctx context.Context, id int) (*Payment, error) {
+	var out Payment
+	if err := s.c.Do(ctx, http.MethodGet, fmt.Sprintf("/payments/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *PaymentsClient) Create(ctx context.Context, in Payment) (*Payment, error) {
+	var out Payment
+	if err := s.c.Do(ctx, http.MethodPost, "/payments", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *PaymentsClient) Update(ctx context.Context, id int, in Payment) (*Payment, error) {
+	var out Payment
+	if err := s.c.Do(ctx, http.MethodPut, fmt.Sprintf("/payments/%d", id), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *PaymentsClient) Delete(ctx context.Context, id int) error {
+	return s.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/payments/%d", id), nil, nil)
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Product mirrors the product service's Product resource.
+type Product struct {
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+	Stock int     `json:"stock"`
+}
+
+// ProductsClient talks to the product service.
+type ProductsClient struct {
+	c *Client
+}
+
+// NewProductsClient creates a client for the product service at baseURL.
+func NewProductsClient(baseURL string, opts ...Option) (*ProductsClient, error) {
+	c, err := New(baseURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ProductsClient{c: c}, nil
+}
+
+func (s *ProductsClient) List(ctx context.Context) ([]Product, error) {
+	var out []Product
+	if err := s.c.Do(ctx, http.MethodGet, "/products", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *ProductsClient) Get(ctx context.Context, id int) (*Product, error) {
+	var out Product
+	if err := s.c.Do(ctx, http.MethodGet, fmt.Sprintf("/products/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *ProductsClient) Create(ctx context.Context, in Product) (*Product, error) {
+	var out Product
+	if err := s.c.Do(ctx, http.MethodPost, "/products", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *ProductsClient) Update(ctx context.Context, id int, in Product) (*Product, error) {
+	var out Product
+	if err := s.c.Do(ctx, http.MethodPut, fmt.Sprintf("/products/%d", id), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (s *ProductsClient) Delete(ctx context.Context, id int) error {
+	return s.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/products/%d", id), nil, nil)
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// User mirrors the user service's User resource.
+type User struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// RegisterRequest is the body of POST /register and POST /users.
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role,omitempty"`
+}
+
+// LoginRequest is the body of POST /login.
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries the JWT issued by POST /login.
+type LoginResponse struct {
+	Token string `json:"token"`
+	Role  string `json:"role"`
+}
+
+// UsersClient talks to the user service.
+type UsersClient struct {
+	c *Client
+}
+
+// NewUsersClient creates a client for the user service at baseURL.
+func NewUsersClient(baseURL string, opts ...Option) (*UsersClient, error) {
+	c, err := New(baseURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &UsersClient{c: c}, nil
+}
+
+// Register creates an account through the public /register endpoint.
+func (u *UsersClient) Register(ctx context.Context, req RegisterRequest) (*User, error) {
+	var out User
+	if err := u.c.Do(ctx, http.MethodPost, "/register", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Login exchanges credentials for a JWT.
+func (u *UsersClient) Login(ctx context.Context, email, password string) (*LoginResponse, error) {
+	var out LoginResponse
+	if err := u.c.Do(ctx, http.MethodPost, "/login", LoginRequest{Email: email, Password: password}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Refresh exchanges the client's still-valid token for a new one.
+func (u *UsersClient) Refresh(ctx context.Context) (*LoginResponse, error) {
+	var out LoginResponse
+	if err := u.c.Do(ctx, http.MethodPost, "/refresh", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (u *UsersClient) List(ctx context.Context) ([]User, error) {
+	var out []User
+	if err := u.c.Do(ctx, http.MethodGet, "/users", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (u *UsersClient) Get(ctx context.Context, id int) (*User, error) {
+	var out User
+	if err := u.c.Do(ctx, http.MethodGet, fmt.Sprintf("/users/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (u *UsersClient) Create(ctx context.Context, req RegisterRequest) (*User, error) {
+	var out User
+	if err := u.c.Do(ctx, http.MethodPost, "/users", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (u *UsersClient) Update(ctx context.Context, id int, user User) (*User, error) {
+	var out User
+	if err := u.c.Do(ctx, http.MethodPut, fmt.Sprintf("/users/%d", id), user, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (u *UsersClient) Delete(ctx context.Context, id int) error {
+	return u.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/users/%d", id), nil, nil)
+}